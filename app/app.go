@@ -0,0 +1,8 @@
+// Package app holds the built web app, when it is embedded into the server.
+package app
+
+import "io/fs"
+
+// Dist is the content of dist, nil unless the server is built with the
+// embedapp tag after the web app.
+var Dist fs.FS
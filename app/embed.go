@@ -0,0 +1,18 @@
+//go:build embedapp
+
+package app
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+func init() {
+	var err error
+	if Dist, err = fs.Sub(dist, "dist"); err != nil {
+		panic(err)
+	}
+}
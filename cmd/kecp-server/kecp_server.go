@@ -1,62 +1,424 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io/fs"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/caddyserver/certmagic"
+	"github.com/fourdim/kecp/app"
+	"github.com/fourdim/kecp/config"
+	kecpbroker "github.com/fourdim/kecp/modules/kecp-broker"
+	kecpsfu "github.com/fourdim/kecp/modules/kecp-sfu"
+	kecpsignal "github.com/fourdim/kecp/modules/kecp-signal"
+	kecpstore "github.com/fourdim/kecp/modules/kecp-store"
+	kecpturn "github.com/fourdim/kecp/modules/kecp-turn"
 	"github.com/fourdim/kecp/router"
-	"github.com/pelletier/go-toml/v2"
+	"github.com/fourdim/kecp/services"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
 )
 
-var App struct {
-	Server struct {
-		Debug          bool
-		TLS            bool
-		Host           string
-		AllowedOrigins []string `toml:"allowed_origins"`
-	}
+const configUsage = "the config file, " + config.DefaultPath + " if it exists by default"
+
+// appDist is the directory of the built web app, served when it is not embedded.
+const appDist = "./app/dist"
+
+// defaultICEServers are advertised when no ICE server is configured.
+var defaultICEServers = []kecpturn.ICEServer{
+	{URLs: []string{"stun:stun.stunprotocol.org"}},
 }
 
 func main() {
-	b, err := os.ReadFile("config.toml")
+	configPath := flag.String("config", "", configUsage)
+	flag.Parse()
+	if flag.Arg(0) == "config" {
+		os.Exit(configCommand(*configPath, flag.Args()[1:]))
+	}
+
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Panicln(err)
+		log.Fatalln(err)
 	}
 
-	toml.Unmarshal(b, &App)
+	var logLevel slog.LevelVar
+	logLevel.UnmarshalText([]byte(cfg.Log.Level))
+	logger, err := newLogger(cfg.Log.Format, &logLevel)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	slog.SetDefault(logger)
+	kecpsignal.SetLeveledLogger(logger)
 
+	// The routes are set up before the servers are started.
 	kecpApiServerRouter := chi.NewRouter()
+	servers, err := listenServers(cfg, kecpApiServerRouter)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var turnICEServers []kecpturn.ICEServer
+	turnURLs := cfg.Turn.URLs
+	if cfg.Turn.Enabled {
+		turnHost := cfg.Server.Host
+		if host, _, err := net.SplitHostPort(turnHost); err == nil {
+			turnHost = host
+		}
+		turnServer, err := kecpturn.Start(kecpturn.Config{
+			Realm:    cfg.Turn.Realm,
+			Host:     turnHost,
+			PublicIP: cfg.Turn.PublicIP,
+			ListenIP: cfg.Turn.ListenIP,
+			UDPPort:  cfg.Turn.UDPPort,
+			TCPPort:  cfg.Turn.TCPPort,
+			Secret:   cfg.Turn.Secret,
+			Username: cfg.Turn.Username,
+			Password: cfg.Turn.Password,
+		})
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer turnServer.Close()
+		turnICEServers = turnServer.ICEServers()
+		turnURLs = append(turnURLs, turnServer.TURNURLs()...)
+	}
+	iceServers := advertisedICEServers(cfg.ICE, turnICEServers)
+	var turnCredentials *kecpturn.CredentialIssuer
+	if cfg.Turn.Secret != "" && len(turnURLs) > 0 {
+		turnCredentials = &kecpturn.CredentialIssuer{
+			Secret: cfg.Turn.Secret,
+			TTL:    time.Duration(cfg.Turn.CredentialTTL) * time.Second,
+			URIs:   turnURLs,
+		}
+	}
+
+	registryOptions := []kecpsignal.RegistryOption{
+		kecpsignal.WithInviteSecret([]byte(cfg.Server.InviteSecret)),
+		kecpsignal.WithLimits(registryLimits(cfg)),
+	}
+	if cfg.Relay.Enabled {
+		registryOptions = append(registryOptions, kecpsignal.WithRelayConfig(kecpsfu.Config{ICEServers: iceServers}))
+	}
+	if cfg.Broker.RedisURL != "" {
+		broker, err := kecpbroker.NewRedis(cfg.Broker.RedisURL)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer broker.Close()
+		registryOptions = append(registryOptions, kecpsignal.WithBroker(broker))
+	}
+	if cfg.Store.Path != "" {
+		store, err := kecpstore.OpenBolt(cfg.Store.Path)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer store.Close()
+		registryOptions = append(registryOptions, kecpsignal.WithStore(store))
+	}
+
+	reg := kecpsignal.NewRegistry(registryOptions...)
+
+	live := &liveConfig{
+		path:           *configPath,
+		running:        cfg,
+		reg:            reg,
+		logLevel:       &logLevel,
+		origins:        services.NewOriginPolicy(cfg.Server.AllowedOrigins),
+		iceServers:     services.NewICEServerList(iceServers),
+		turnICEServers: turnICEServers,
+	}
+
+	rejectedOrigins := services.NewRejectedOriginsCounter()
+	kecpsignal.MustRegisterMetrics(rejectedOrigins)
 
 	kecpApiServerRouter.Route("/api", func(r chi.Router) {
 		r.Use(cors.Handler(cors.Options{
-			// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
-			AllowedOrigins: App.Server.AllowedOrigins,
-			// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowedHeaders:   []string{"Accept", "Content-Type", "Upgrade", "Connection", "Sec-WebSocket-Key", "Sec-WebSocket-Protocol", "Sec-WebSocket-Version", "Sec-WebSocket-Extensions"},
+			// The allowed origins may be reloaded.
+			AllowOriginFunc: func(r *http.Request, origin string) bool {
+				return live.origins.Allows(origin)
+			},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Upgrade", "Connection", "Sec-WebSocket-Key", "Sec-WebSocket-Protocol", "Sec-WebSocket-Version", "Sec-WebSocket-Extensions"},
 			ExposedHeaders:   []string{"Sec-WebSocket-Accept", "Sec-WebSocket-Protocol", "Sec-WebSocket-Extensions"},
 			AllowCredentials: false,
 			MaxAge:           300, // Maximum value not ignored by any of major browsers
 		}))
-		r.Mount("/kecp", router.SetupKecpChiRouter())
+		r.Mount("/kecp", router.SetupKecpChiRouter(reg, router.KecpOptions{
+			ICEServers:      live.iceServers,
+			TURNCredentials: turnCredentials,
+			Origins:         live.origins,
+			RejectedOrigins: rejectedOrigins,
+		}))
+		if cfg.Admin.Token != "" {
+			r.Mount("/admin", router.SetupAdminChiRouter(reg, cfg.Admin.Token))
+		}
 	})
 
-	kecpApiServerRouter.NotFound(ServeRoot("/", "./app/dist"))
+	appFiles := appFileSystem(cfg.App.Dir)
+	readyChecks := map[string]services.ReadyCheck{
+		"app": func(ctx context.Context) error {
+			f, err := appFiles.Open("/" + INDEX)
+			if err != nil {
+				return err
+			}
+			return f.Close()
+		},
+	}
+	if len(turnURLs) > 0 {
+		readyChecks["turn"] = func(ctx context.Context) error {
+			for _, url := range turnURLs {
+				if err := kecpturn.Ping(ctx, url); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	kecpApiServerRouter.Get("/healthz", services.HealthHandler())
+	kecpApiServerRouter.Get("/readyz", services.ReadyHandler(reg, readyChecks))
+
+	kecpApiServerRouter.NotFound(Serve("/", appFiles))
+
+	if cfg.Metrics.Listen != "" {
+		metricsRouter := chi.NewRouter()
+		metricsRouter.Handle("/metrics", kecpsignal.MetricsHandler())
+		servers = append(servers, &http.Server{Addr: cfg.Metrics.Listen, Handler: metricsRouter})
+	}
+	serverErr := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			if server.TLSConfig != nil {
+				serverErr <- server.ListenAndServeTLS("", "")
+			} else {
+				serverErr <- server.ListenAndServe()
+			}
+		}(server)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	hangUp := make(chan os.Signal, 1)
+	signal.Notify(hangUp, syscall.SIGHUP)
+serve:
+	for {
+		select {
+		case err := <-serverErr:
+			log.Println(err)
+			break serve
+		case <-stop:
+			break serve
+		case <-hangUp:
+			live.reload()
+		}
+	}
+
+	shutdownTimeout := time.Duration(cfg.Server.ShutdownTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	// The websockets are not tracked by the HTTP servers.
+	if err := reg.Shutdown(ctx, time.Duration(cfg.Server.ReconnectAfter)*time.Second); err != nil {
+		log.Println(err)
+	}
+	closeRegistry(reg, shutdownTimeout)
+
+	ctx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// closeRegistry waits for the rooms and the pumps of the clients to be done,
+// so that nothing writes to the store and the broker once they are closed.
+// If they are not done in time, the server exits without closing them.
+func closeRegistry(reg *kecpsignal.Registry, timeout time.Duration) {
+	closed := make(chan error, 1)
+	go func() {
+		closed <- reg.Close()
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-closed:
+		if err != nil {
+			log.Println(err)
+		}
+	case <-timer.C:
+		log.Fatalln("the registry did not close in time")
+	}
+}
+
+// newLogger makes the logger writing to stderr in the format from the level on.
+func newLogger(format string, level slog.Leveler) (*slog.Logger, error) {
+	options := slog.HandlerOptions{Level: level}
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, &options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, &options)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// appFileSystem serves the web app from the directory if any, or the
+// embedded one, or the one in appDist if it is not embedded.
+func appFileSystem(dir string) ServeFileSystem {
+	if dir == "" && app.Dist != nil {
+		return EmbedFile(app.Dist, false)
+	}
+	if dir == "" {
+		dir = appDist
+	}
+	return LocalFile(dir, false)
+}
+
+// advertisedICEServers are the configured ICE servers and the ones
+// of the embedded TURN server, or the default ones if there are none.
+func advertisedICEServers(configured []kecpturn.ICEServer, turn []kecpturn.ICEServer) []kecpturn.ICEServer {
+	iceServers := append(append([]kecpturn.ICEServer{}, configured...), turn...)
+	if len(iceServers) == 0 {
+		return defaultICEServers
+	}
+	return iceServers
+}
+
+// registryLimits are the limits of the rooms and the clients in the config.
+func registryLimits(cfg *config.Config) kecpsignal.Limits {
+	return kecpsignal.Limits{
+		MaxRooms:          cfg.Limits.MaxRooms,
+		MaxMembers:        cfg.Limits.MaxMembers,
+		MessagesPerSecond: cfg.Limits.MessagesPerSecond,
+	}
+}
+
+// liveConfig applies the settings which may change while the server runs.
+type liveConfig struct {
+	path           string
+	running        *config.Config
+	reg            *kecpsignal.Registry
+	logLevel       *slog.LevelVar
+	origins        *services.OriginPolicy
+	iceServers     *services.ICEServerList
+	turnICEServers []kecpturn.ICEServer
+}
+
+// reload reads the config again and applies its live settings, and tells
+// which of the others wait for a restart. The running config is kept
+// if the new one is not valid.
+func (l *liveConfig) reload() {
+	next, err := config.Load(l.path)
+	if err != nil {
+		slog.Error("config not reloaded", "error", err)
+		return
+	}
+	restart := l.running.Reload(next)
+	l.logLevel.UnmarshalText([]byte(l.running.Log.Level))
+	l.origins.Update(l.running.Server.AllowedOrigins)
+	l.reg.SetLimits(registryLimits(l.running))
+	l.iceServers.Set(advertisedICEServers(l.running.ICE, l.turnICEServers))
+	slog.Info("config reloaded")
+	if len(restart) > 0 {
+		slog.Warn("config changes wait for a restart", "settings", strings.Join(restart, ", "))
+	}
+}
+
+// configCommand runs the config subcommands and returns the exit code.
+// "config check" prints the effective config or what is wrong with it.
+func configCommand(configPath string, args []string) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "usage: kecp-server config check [--config path]")
+		return 2
+	}
+	flags := flag.NewFlagSet("config check", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", configPath, configUsage)
+	flags.Parse(args[1:])
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Print(cfg)
+	return 0
+}
 
-	if App.Server.Debug || !App.Server.TLS {
-		http.ListenAndServe(":8090", kecpApiServerRouter)
+// listenServers makes the servers of the handler from the server config.
+func listenServers(cfg *config.Config, handler http.Handler) ([]*http.Server, error) {
+	if !cfg.UsesTLS() {
+		return []*http.Server{{Addr: cfg.Server.HTTPListen, Handler: handler}}, nil
+	}
+	return httpsServers(cfg, handler)
+}
+
+// httpsServers serves the handler over HTTPS with the certificate files or
+// the automatic certificates of the host, and solves the HTTP challenge and
+// redirects to HTTPS over HTTP.
+func httpsServers(cfg *config.Config, handler http.Handler) ([]*http.Server, error) {
+	var tlsConfig *tls.Config
+	var challenge func(http.Handler) http.Handler
+	if cfg.Server.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Server.CertFile, cfg.Server.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("server.cert_file and server.key_file: %w", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
 	} else {
-		certmagic.HTTPS([]string{App.Server.Host}, kecpApiServerRouter)
+		ca := cfg.ACMEDirectory()
+		certmagic.DefaultACME.Agreed = true
+		certmagic.DefaultACME.CA = ca
+		if ca != certmagic.LetsEncryptProductionCA {
+			// Certmagic retries with the staging CA of Let's Encrypt otherwise.
+			certmagic.DefaultACME.TestCA = ca
+		}
+		certmagic.DefaultACME.Email = cfg.Server.ACMEEmail
+		magic := certmagic.NewDefault()
+		if err := magic.ManageSync(context.Background(), []string{cfg.Server.Host}); err != nil {
+			return nil, fmt.Errorf("certificate of %s: %w", cfg.Server.Host, err)
+		}
+		tlsConfig = magic.TLSConfig()
+		if issuer, ok := magic.Issuers[0].(*certmagic.ACMEIssuer); ok {
+			challenge = issuer.HTTPChallengeHandler
+		}
 	}
+	tlsConfig.NextProtos = append([]string{"h2", "http/1.1"}, tlsConfig.NextProtos...)
 
+	servers := []*http.Server{
+		{Addr: cfg.Server.HTTPSListen, Handler: handler, TLSConfig: tlsConfig, ReadHeaderTimeout: 10 * time.Second},
+	}
+	if cfg.Server.RedirectHTTP {
+		_, httpsPort, _ := net.SplitHostPort(cfg.Server.HTTPSListen)
+		var redirect http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if httpsPort != "443" {
+				host = net.JoinHostPort(host, httpsPort)
+			}
+			w.Header().Set("Connection", "close")
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+		})
+		if challenge != nil {
+			redirect = challenge(redirect)
+		}
+		servers = append(servers, &http.Server{Addr: cfg.Server.HTTPListen, Handler: redirect, ReadHeaderTimeout: 5 * time.Second})
+	}
+	return servers, nil
 }
 
 const INDEX = "index.html"
@@ -101,12 +463,52 @@ func (l *localFileSystem) Exists(prefix string, filepath string) bool {
 	return false
 }
 
+type embedFileSystem struct {
+	http.FileSystem
+	fs      fs.FS
+	indexes bool
+}
+
+func EmbedFile(fsys fs.FS, indexes bool) *embedFileSystem {
+	return &embedFileSystem{
+		FileSystem: http.FS(fsys),
+		fs:         fsys,
+		indexes:    indexes,
+	}
+}
+
+func (e *embedFileSystem) Exists(prefix string, filepath string) bool {
+	if p := strings.TrimPrefix(filepath, prefix); len(p) < len(filepath) {
+		// The names of an fs.FS are unrooted.
+		name := strings.TrimPrefix(path.Join("/", p), "/")
+		if name == "" {
+			name = "."
+		}
+		stats, err := fs.Stat(e.fs, name)
+		if err != nil {
+			return false
+		}
+		if stats.IsDir() {
+			if !e.indexes {
+				index := path.Join(name, INDEX)
+				_, err := fs.Stat(e.fs, index)
+				if err != nil {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
 func ServeRoot(urlPrefix, root string) http.HandlerFunc {
-	return Serve(urlPrefix, root, LocalFile(root, false))
+	return Serve(urlPrefix, LocalFile(root, false))
 }
 
-// Static returns a middleware handler that serves static files in the given directory.
-func Serve(urlPrefix string, root string, fs ServeFileSystem) http.HandlerFunc {
+// Static returns a middleware handler that serves static files in the given file system,
+// and the index for the paths which are not files, so that the web app routes them.
+func Serve(urlPrefix string, fs ServeFileSystem) http.HandlerFunc {
 	fileserver := http.FileServer(fs)
 	if urlPrefix != "" {
 		fileserver = http.StripPrefix(urlPrefix, fileserver)
@@ -115,10 +517,11 @@ func Serve(urlPrefix string, root string, fs ServeFileSystem) http.HandlerFunc {
 		if fs.Exists(urlPrefix, r.URL.Path) {
 			fileserver.ServeHTTP(w, r)
 		} else {
-			f, err := os.Open(path.Join(root, INDEX))
+			f, err := fs.Open("/" + INDEX)
 			if err != nil {
 				return
 			}
+			defer f.Close()
 			http.ServeContent(w, r, INDEX, time.Now(), f)
 		}
 	}
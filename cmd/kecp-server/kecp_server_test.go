@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func get(t *testing.T, handler http.Handler, target string) (int, string) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	b, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(b)
+}
+
+func TestServe(t *testing.T) {
+	files := map[string]string{
+		"index.html":          "index",
+		"assets/app.js":       "app",
+		"docs/index.html":     "docs",
+		"empty/.gitkeep":      "",
+		"favicon.ico":         "icon",
+		"assets/nested/a.css": "css",
+	}
+	dir := t.TempDir()
+	embedded := fstest.MapFS{}
+	for name, content := range files {
+		embedded[name] = &fstest.MapFile{Data: []byte(content)}
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, fs := range map[string]ServeFileSystem{
+		"disk":     LocalFile(dir, false),
+		"embedded": EmbedFile(embedded, false),
+	} {
+		t.Run(name, func(t *testing.T) {
+			handler := Serve("/", fs)
+			for target, body := range map[string]string{
+				"/":                    "index",
+				"/assets/app.js":       "app",
+				"/assets/nested/a.css": "css",
+				"/docs/":               "docs",
+				"/favicon.ico":         "icon",
+				"/rooms/abc":           "index",
+				"/empty/":              "index",
+			} {
+				code, got := get(t, handler, target)
+				assert.Equal(t, http.StatusOK, code, target)
+				assert.Equal(t, body, got, target)
+			}
+		})
+	}
+}
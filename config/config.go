@@ -0,0 +1,346 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	kecpturn "github.com/fourdim/kecp/modules/kecp-turn"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// DefaultPath is the config read when no path is given, if it exists.
+const DefaultPath = "config.toml"
+
+// EnvPrefix starts the environment variables overriding the settings,
+// such as KECP_SERVER_HOST for host in [server].
+const EnvPrefix = "KECP_"
+
+const (
+	// DefaultHTTPListen is the address of the plain HTTP listener without TLS.
+	DefaultHTTPListen = ":8090"
+
+	// DefaultRedirectListen is the address of the plain HTTP listener with TLS.
+	DefaultRedirectListen = ":80"
+)
+
+type Config struct {
+	Server  Server               `toml:"server"`
+	Turn    Turn                 `toml:"turn"`
+	Relay   Relay                `toml:"relay"`
+	Broker  Broker               `toml:"broker"`
+	Store   Store                `toml:"store"`
+	Limits  Limits               `toml:"limits"`
+	Metrics Metrics              `toml:"metrics"`
+	Admin   Admin                `toml:"admin"`
+	Log     Log                  `toml:"log"`
+	App     App                  `toml:"app"`
+	ICE     []kecpturn.ICEServer `toml:"ice_servers"`
+}
+
+type Server struct {
+	Debug          bool     `toml:"debug"`
+	TLS            bool     `toml:"tls"`
+	Host           string   `toml:"host"`
+	AllowedOrigins []string `toml:"allowed_origins"`
+	InviteSecret   string   `toml:"invite_secret" secret:"true"`
+
+	// The seconds allowed for the clients to be closed on shutdown.
+	ShutdownTimeout int64 `toml:"shutdown_timeout"`
+
+	// The seconds the clients are told to wait before reconnecting.
+	ReconnectAfter int64 `toml:"reconnect_after"`
+
+	// The address of the plain HTTP listener, the host or :8090 by default,
+	// or :80 with TLS.
+	HTTPListen string `toml:"http_listen"`
+
+	// The address of the HTTPS listener.
+	HTTPSListen string `toml:"https_listen"`
+
+	// The certificate and its key, empty for the automatic certificates of the host.
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
+
+	// The ACME directory issuing the automatic certificates,
+	// "production" or "staging" of Let's Encrypt or its URL.
+	ACMECA string `toml:"acme_ca"`
+
+	// The email the CA tells about the certificates.
+	ACMEEmail string `toml:"acme_email"`
+
+	// Whether the plain HTTP listener redirects to HTTPS with TLS.
+	RedirectHTTP bool `toml:"redirect_http"`
+}
+
+type Turn struct {
+	Enabled  bool   `toml:"enabled"`
+	Realm    string `toml:"realm"`
+	PublicIP string `toml:"public_ip"`
+	ListenIP string `toml:"listen_ip"`
+	UDPPort  int    `toml:"udp_port"`
+	TCPPort  int    `toml:"tcp_port"`
+	Username string `toml:"username"`
+	Password string `toml:"password" secret:"true"`
+
+	// The shared secret of the short-lived credentials.
+	Secret string `toml:"secret" secret:"true"`
+
+	// The lifetime of the short-lived credentials in seconds.
+	CredentialTTL int64 `toml:"credential_ttl"`
+
+	// The URLs of the external TURN servers sharing the secret.
+	URLs []string `toml:"urls"`
+}
+
+type Relay struct {
+	Enabled bool `toml:"enabled"`
+}
+
+type Broker struct {
+	// The Redis server sharing the rooms between the nodes, empty for a single node.
+	RedisURL string `toml:"redis_url" secret:"true"`
+}
+
+type Store struct {
+	// The file keeping the rooms across restarts, empty to forget them.
+	Path string `toml:"path"`
+}
+
+type Limits struct {
+	// The rooms created on this node, 0 for unlimited.
+	MaxRooms int `toml:"max_rooms"`
+
+	// The member count of the rooms, which may ask for fewer, 0 for unlimited.
+	MaxMembers int `toml:"max_members"`
+
+	// The messages each client may send per second, 0 for unlimited.
+	MessagesPerSecond int `toml:"messages_per_second"`
+}
+
+type Metrics struct {
+	// The address serving /metrics apart from the API, empty to disable it.
+	Listen string `toml:"listen"`
+}
+
+type Admin struct {
+	// The bearer token of the admin API, empty to disable it.
+	Token string `toml:"token" secret:"true"`
+}
+
+type Log struct {
+	// "text" or "json".
+	Format string `toml:"format"`
+
+	// "debug", "info", "warn" or "error".
+	Level string `toml:"level"`
+}
+
+type App struct {
+	// The directory of the built web app served instead of the embedded one,
+	// for the development of the web app.
+	Dir string `toml:"dir"`
+}
+
+// Default returns the settings used when they are neither in the file
+// nor in the environment.
+func Default() *Config {
+	c := &Config{}
+	c.Server.ShutdownTimeout = 10
+	c.Server.ReconnectAfter = 5
+	c.Server.HTTPSListen = ":443"
+	c.Server.RedirectHTTP = true
+	c.Turn.UDPPort = 3478
+	c.Turn.CredentialTTL = 6 * 60 * 60
+	c.Log.Format = "text"
+	c.Log.Level = "info"
+	return c
+}
+
+// Load reads the config at the path over the defaults, or the one at
+// DefaultPath if the path is empty and it exists, then applies the
+// environment variables and validates the result.
+func Load(path string) (*Config, error) {
+	c := Default()
+	if path == "" {
+		path = DefaultPath
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			path = ""
+		}
+	}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := decode(b, c); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(c).Elem(), EnvPrefix, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	c.fill()
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// decode reads the TOML document into the config, refusing the unknown keys.
+func decode(b []byte, c *Config) error {
+	err := toml.NewDecoder(bytes.NewReader(b)).DisallowUnknownFields().Decode(c)
+	var strictErr *toml.StrictMissingError
+	if errors.As(err, &strictErr) {
+		var keys []string
+		for _, e := range strictErr.Errors {
+			keys = append(keys, strings.Join(e.Key(), "."))
+		}
+		return fmt.Errorf("unknown keys: %s", strings.Join(keys, ", "))
+	}
+	var decodeErr *toml.DecodeError
+	if errors.As(err, &decodeErr) {
+		row, column := decodeErr.Position()
+		return fmt.Errorf("line %d, column %d: %w", row, column, err)
+	}
+	return err
+}
+
+// applyEnv sets the fields of the struct from the environment variables
+// named after their keys, with the strings separated by commas for the lists.
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := prefix + strings.ToUpper(field.Tag.Get("toml"))
+		value := v.Field(i)
+		if value.Kind() == reflect.Struct {
+			if err := applyEnv(value, name+"_", lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		s, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		switch value.Kind() {
+		case reflect.String:
+			value.SetString(s)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			value.SetBool(b)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			value.SetInt(n)
+		case reflect.Slice:
+			if value.Type().Elem().Kind() != reflect.String {
+				return fmt.Errorf("%s: not settable from the environment", name)
+			}
+			var list []string
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			value.Set(reflect.ValueOf(list))
+		}
+	}
+	return nil
+}
+
+// fill sets the defaults depending on the other settings.
+func (c *Config) fill() {
+	if c.Server.HTTPListen != "" {
+		return
+	}
+	if c.UsesTLS() {
+		c.Server.HTTPListen = DefaultRedirectListen
+		return
+	}
+	c.Server.HTTPListen = DefaultHTTPListen
+	if _, _, err := net.SplitHostPort(c.Server.Host); err == nil {
+		c.Server.HTTPListen = c.Server.Host
+	}
+}
+
+// UsesTLS tells whether the server is served over HTTPS.
+func (c *Config) UsesTLS() bool {
+	return c.Server.TLS && !c.Server.Debug
+}
+
+// String prints the config as TOML, with the secrets hidden.
+func (c *Config) String() string {
+	redacted := *c
+	redact(reflect.ValueOf(&redacted).Elem())
+	redacted.ICE = nil
+	for _, server := range c.ICE {
+		if server.Credential != "" {
+			server.Credential = "********"
+		}
+		redacted.ICE = append(redacted.ICE, server)
+	}
+	b, err := toml.Marshal(&redacted)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+func redact(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		value := v.Field(i)
+		if value.Kind() == reflect.Struct {
+			redact(value)
+		} else if t.Field(i).Tag.Get("secret") == "true" && value.String() != "" {
+			value.SetString("********")
+		}
+	}
+}
+
+// liveSettings can change while the server runs.
+var liveSettings = map[string]bool{
+	"server.allowed_origins":     true,
+	"limits.max_rooms":           true,
+	"limits.max_members":         true,
+	"limits.messages_per_second": true,
+	"log.level":                  true,
+	"ice_servers":                true,
+}
+
+// Reload takes the live settings of the next config, and returns the keys
+// of the other settings which differ, and so wait for a restart.
+func (c *Config) Reload(next *Config) (restart []string) {
+	return reload(reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem(), "")
+}
+
+func reload(current reflect.Value, next reflect.Value, prefix string) (restart []string) {
+	t := current.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := prefix + t.Field(i).Tag.Get("toml")
+		value, nextValue := current.Field(i), next.Field(i)
+		switch {
+		case value.Kind() == reflect.Struct:
+			restart = append(restart, reload(value, nextValue, key+".")...)
+		case reflect.DeepEqual(value.Interface(), nextValue.Interface()):
+		case liveSettings[key]:
+			value.Set(nextValue)
+		default:
+			restart = append(restart, key)
+		}
+	}
+	return restart
+}
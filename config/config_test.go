@@ -0,0 +1,176 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/fourdim/kecp/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `
+[server]
+host = "127.0.0.1:8091"
+allowed_origins = ["https://*.example.com"]
+shutdown_timeout = 30
+
+[[ice_servers]]
+urls = ["stun:stun.example.com:3478"]
+`))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "127.0.0.1:8091", cfg.Server.HTTPListen)
+	assert.Equal(t, []string{"https://*.example.com"}, cfg.Server.AllowedOrigins)
+	assert.Equal(t, int64(30), cfg.Server.ShutdownTimeout)
+	assert.Equal(t, int64(5), cfg.Server.ReconnectAfter)
+	assert.Equal(t, "info", cfg.Log.Level)
+	assert.Len(t, cfg.ICE, 1)
+
+	cfg, err = Load(writeConfig(t, `
+[server]
+tls = true
+host = "example.com"
+cert_file = "cert.pem"
+key_file = "key.pem"
+`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, DefaultRedirectListen, cfg.Server.HTTPListen)
+		assert.True(t, cfg.UsesTLS())
+	}
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.toml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	_, err := Load(writeConfig(t, `
+[server]
+hots = "example.com"
+
+[tunr]
+enabled = true
+`))
+	assert.ErrorContains(t, err, "unknown keys: server.hots, tunr")
+
+	_, err = Load(writeConfig(t, `
+[server]
+shutdown_timeout = "soon"
+`))
+	assert.ErrorContains(t, err, "line 3")
+}
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("KECP_SERVER_HOST", "127.0.0.1:8092")
+	t.Setenv("KECP_SERVER_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+	t.Setenv("KECP_RELAY_ENABLED", "true")
+	t.Setenv("KECP_TURN_CREDENTIAL_TTL", "600")
+	t.Setenv("KECP_ADMIN_TOKEN", "token")
+	cfg, err := Load(writeConfig(t, `
+[server]
+host = "127.0.0.1:8091"
+
+[admin]
+token = "overridden"
+`))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "127.0.0.1:8092", cfg.Server.HTTPListen)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.Server.AllowedOrigins)
+	assert.True(t, cfg.Relay.Enabled)
+	assert.Equal(t, int64(600), cfg.Turn.CredentialTTL)
+	assert.Equal(t, "token", cfg.Admin.Token)
+
+	t.Setenv("KECP_SERVER_SHUTDOWN_TIMEOUT", "soon")
+	_, err = Load(writeConfig(t, ""))
+	assert.ErrorContains(t, err, "KECP_SERVER_SHUTDOWN_TIMEOUT")
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		change func(cfg *Config)
+		err    string
+	}{
+		{"listen", func(cfg *Config) { cfg.Server.HTTPListen = "8090" }, "server.http_listen"},
+		{"shutdown timeout", func(cfg *Config) { cfg.Server.ShutdownTimeout = 0 }, "server.shutdown_timeout must be positive"},
+		{"cert without key", func(cfg *Config) {
+			cfg.Server.TLS = true
+			cfg.Server.CertFile = "cert.pem"
+		}, "server.cert_file and server.key_file must be set together"},
+		{"host with port", func(cfg *Config) {
+			cfg.Server.TLS = true
+			cfg.Server.Host = "example.com:443"
+		}, "without a port"},
+		{"acme ca", func(cfg *Config) {
+			cfg.Server.TLS = true
+			cfg.Server.Host = "example.com"
+			cfg.Server.ACMECA = "http://ca.example.com"
+		}, "server.acme_ca must be"},
+		{"same listeners", func(cfg *Config) {
+			cfg.Server.TLS = true
+			cfg.Server.Host = "example.com"
+			cfg.Server.HTTPListen = ":443"
+		}, "must differ"},
+		{"origin", func(cfg *Config) { cfg.Server.AllowedOrigins = []string{"example.com"} }, "server.allowed_origins"},
+		{"turn", func(cfg *Config) { cfg.Turn.Enabled = true }, "turn.realm must be set"},
+		{"turn urls", func(cfg *Config) { cfg.Turn.URLs = []string{"http://turn.example.com"} }, "turn.urls"},
+		{"redis", func(cfg *Config) { cfg.Broker.RedisURL = "localhost:6379" }, "broker.redis_url"},
+		{"redis invite secret", func(cfg *Config) { cfg.Broker.RedisURL = "redis://localhost:6379" }, "server.invite_secret must be set"},
+		{"store invite secret", func(cfg *Config) { cfg.Store.Path = "kecp.db" }, "server.invite_secret must be set with store.path"},
+		{"limits", func(cfg *Config) { cfg.Limits.MaxRooms = -1 }, "limits.max_rooms must be 0 or positive"},
+		{"metrics", func(cfg *Config) { cfg.Metrics.Listen = cfg.Server.HTTPListen }, "metrics.listen must differ"},
+		{"log format", func(cfg *Config) { cfg.Log.Format = "xml" }, "log.format"},
+		{"app dir", func(cfg *Config) { cfg.App.Dir = "missing" }, "app.dir must be a directory"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Server.HTTPListen = DefaultHTTPListen
+			tt.change(cfg)
+			assert.ErrorContains(t, cfg.Validate(), tt.err)
+		})
+	}
+
+	cfg := Default()
+	cfg.Server.HTTPListen = DefaultHTTPListen
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestString(t *testing.T) {
+	cfg := Default()
+	cfg.Server.InviteSecret = "invite secret"
+	cfg.Admin.Token = "admin token"
+	s := cfg.String()
+	assert.NotContains(t, s, "invite secret")
+	assert.NotContains(t, s, "admin token")
+	assert.Contains(t, s, "shutdown_timeout = 10")
+	assert.Equal(t, "admin token", cfg.Admin.Token)
+}
+
+func TestReload(t *testing.T) {
+	cfg := Default()
+	next := Default()
+	next.Server.AllowedOrigins = []string{"https://example.com"}
+	next.Log.Level = "debug"
+	next.Limits.MaxMembers = 8
+	next.Server.Host = "example.com"
+	next.Turn.Enabled = true
+	assert.Equal(t, []string{"server.host", "turn.enabled"}, cfg.Reload(next))
+	assert.Equal(t, []string{"https://example.com"}, cfg.Server.AllowedOrigins)
+	assert.Equal(t, "debug", cfg.Log.Level)
+	assert.Equal(t, 8, cfg.Limits.MaxMembers)
+	assert.Empty(t, cfg.Server.Host, "kept until a restart")
+	assert.Equal(t, []string{"server.host", "turn.enabled"}, cfg.Reload(next))
+	assert.Empty(t, Default().Reload(Default()))
+}
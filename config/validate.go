@@ -0,0 +1,197 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/caddyserver/certmagic"
+	"github.com/pion/ice/v2"
+)
+
+// acmeCAs are the ACME directories of Let's Encrypt by name.
+var acmeCAs = map[string]string{
+	"":           certmagic.LetsEncryptProductionCA,
+	"production": certmagic.LetsEncryptProductionCA,
+	"staging":    certmagic.LetsEncryptStagingCA,
+}
+
+// Validate tells what is wrong with the settings, all at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	check(c.validateServer())
+
+	for _, origin := range c.Server.AllowedOrigins {
+		if origin != "" && origin != "*" && !strings.Contains(origin, "://") {
+			check(fmt.Errorf("server.allowed_origins must be \"*\" or origins like https://example.com, not %q", origin))
+		}
+	}
+
+	if c.Turn.Enabled {
+		if c.Turn.Realm == "" {
+			check(errors.New("turn.realm must be set with turn.enabled"))
+		}
+		if net.ParseIP(c.Turn.PublicIP) == nil {
+			check(fmt.Errorf("turn.public_ip must be an IP, not %q", c.Turn.PublicIP))
+		}
+		if c.Turn.UDPPort <= 0 || c.Turn.UDPPort > 65535 {
+			check(fmt.Errorf("turn.udp_port must be a port, not %d", c.Turn.UDPPort))
+		}
+		if c.Turn.TCPPort < 0 || c.Turn.TCPPort > 65535 {
+			check(fmt.Errorf("turn.tcp_port must be a port or 0, not %d", c.Turn.TCPPort))
+		}
+		if (c.Turn.Username == "") != (c.Turn.Password == "") {
+			check(errors.New("turn.username and turn.password must be set together"))
+		}
+		if c.Turn.Username == "" && c.Turn.Secret == "" {
+			check(errors.New("turn.username and turn.password, or turn.secret, must be set with turn.enabled"))
+		}
+	}
+	if c.Turn.CredentialTTL <= 0 {
+		check(fmt.Errorf("turn.credential_ttl must be positive, not %d", c.Turn.CredentialTTL))
+	}
+	for _, rawURL := range c.Turn.URLs {
+		if _, err := ice.ParseURL(rawURL); err != nil {
+			check(fmt.Errorf("turn.urls: %q: %w", rawURL, err))
+		}
+	}
+	for _, server := range c.ICE {
+		if len(server.URLs) == 0 {
+			check(errors.New("ice_servers.urls must not be empty"))
+		}
+		for _, rawURL := range server.URLs {
+			if _, err := ice.ParseURL(rawURL); err != nil {
+				check(fmt.Errorf("ice_servers.urls: %q: %w", rawURL, err))
+			}
+		}
+	}
+
+	if c.Broker.RedisURL != "" {
+		u, err := url.Parse(c.Broker.RedisURL)
+		if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss" && u.Scheme != "unix") {
+			check(errors.New("broker.redis_url must be a redis://, rediss:// or unix:// URL"))
+		}
+		if c.Server.InviteSecret == "" {
+			check(errors.New("server.invite_secret must be set with broker.redis_url, so that every node accepts the invites"))
+		}
+	}
+
+	for _, limit := range []struct {
+		key   string
+		value int
+	}{
+		{"limits.max_rooms", c.Limits.MaxRooms},
+		{"limits.max_members", c.Limits.MaxMembers},
+		{"limits.messages_per_second", c.Limits.MessagesPerSecond},
+	} {
+		if limit.value < 0 {
+			check(fmt.Errorf("%s must be 0 or positive, not %d", limit.key, limit.value))
+		}
+	}
+
+	if c.Store.Path != "" && c.Server.InviteSecret == "" {
+		check(errors.New("server.invite_secret must be set with store.path, so that the invites of the rooms restored stay valid"))
+	}
+
+	if c.Metrics.Listen != "" {
+		check(checkListen("metrics.listen", c.Metrics.Listen))
+		if c.Metrics.Listen == c.Server.HTTPListen || (c.UsesTLS() && c.Metrics.Listen == c.Server.HTTPSListen) {
+			check(fmt.Errorf("metrics.listen must differ from the addresses of the server, not %s", c.Metrics.Listen))
+		}
+	}
+
+	if c.App.Dir != "" {
+		if info, err := os.Stat(c.App.Dir); err != nil || !info.IsDir() {
+			check(fmt.Errorf("app.dir must be a directory, not %q", c.App.Dir))
+		}
+	}
+
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		check(fmt.Errorf("log.format must be \"text\" or \"json\", not %q", c.Log.Format))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		check(fmt.Errorf("log.level must be \"debug\", \"info\", \"warn\" or \"error\", not %q", c.Log.Level))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Config) validateServer() error {
+	s := &c.Server
+	if s.ShutdownTimeout <= 0 {
+		return fmt.Errorf("server.shutdown_timeout must be positive, not %d", s.ShutdownTimeout)
+	}
+	if s.ReconnectAfter <= 0 {
+		return fmt.Errorf("server.reconnect_after must be positive, not %d", s.ReconnectAfter)
+	}
+	if !c.UsesTLS() {
+		return checkListen("server.http_listen", s.HTTPListen)
+	}
+	if err := checkListen("server.https_listen", s.HTTPSListen); err != nil {
+		return err
+	}
+	if s.RedirectHTTP {
+		if err := checkListen("server.http_listen", s.HTTPListen); err != nil {
+			return err
+		}
+		if s.HTTPListen == s.HTTPSListen {
+			return fmt.Errorf("server.http_listen and server.https_listen must differ, both are %s", s.HTTPListen)
+		}
+	}
+	if s.CertFile != "" || s.KeyFile != "" {
+		if s.CertFile == "" || s.KeyFile == "" {
+			return errors.New("server.cert_file and server.key_file must be set together")
+		}
+		if s.ACMECA != "" || s.ACMEEmail != "" {
+			return errors.New("server.acme_ca and server.acme_email do not apply to server.cert_file")
+		}
+		return nil
+	}
+	if s.Host == "" {
+		return errors.New("server.host must be the domain of the automatic certificates")
+	}
+	if _, _, err := net.SplitHostPort(s.Host); err == nil {
+		return fmt.Errorf("server.host must be the domain of the automatic certificates without a port, not %q", s.Host)
+	}
+	if _, ok := acmeCAs[s.ACMECA]; !ok {
+		u, err := url.Parse(s.ACMECA)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("server.acme_ca must be \"production\", \"staging\" or the https URL of an ACME directory, not %q", s.ACMECA)
+		}
+	}
+	if s.ACMEEmail != "" && !strings.Contains(s.ACMEEmail, "@") {
+		return fmt.Errorf("server.acme_email must be an email, not %q", s.ACMEEmail)
+	}
+	return nil
+}
+
+// ACMEDirectory is the URL of the ACME directory issuing the automatic certificates.
+func (c *Config) ACMEDirectory() string {
+	if ca, ok := acmeCAs[c.Server.ACMECA]; ok {
+		return ca
+	}
+	return c.Server.ACMECA
+}
+
+// checkListen tells what is wrong with the listen address of the setting.
+func checkListen(setting string, addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", setting, err)
+	}
+	if _, err := net.LookupPort("tcp", port); err != nil {
+		return fmt.Errorf("%s: %w", setting, err)
+	}
+	return nil
+}
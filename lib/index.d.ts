@@ -1,5 +1,5 @@
 import KecpSignal from './src/signal';
-import KecpRoom from './src/room';
+import KecpRoom, { RelayName } from './src/room';
 import AnswerPeer from './src/video-answer';
 import VideoOfferPeer from './src/video-offer';
 
@@ -9,6 +9,9 @@ export type {
   ErrResponse,
   KecpRoomOption,
   KecpMessage,
+  PeerLink,
+  PeerPlan,
+  RestartNotice,
 } from './src/types';
 
 export {
@@ -19,6 +22,7 @@ export {
 export {
   KecpSignal,
   KecpRoom,
+  RelayName,
   AnswerPeer,
   VideoOfferPeer,
 };
@@ -10,6 +10,8 @@ export enum KecpMessageType {
     Join = 'join',
     Leave = 'leave',
     Error = 'error',
+    Plan = 'plan',
+    Restarting = 'server-restarting',
 }
 
 export enum KecpEventType {
@@ -24,4 +26,6 @@ export enum KecpEventType {
     UserListInit = 'userlist-init',
     UserJoin = 'userlist-join',
     UserLeave = 'userlist-leave',
+    Plan = 'plan',
+    Restarting = 'server-restarting',
 }
@@ -1,5 +1,5 @@
 import KecpSignal from './signal';
-import KecpRoom from './room';
+import KecpRoom, { RelayName } from './room';
 import AnswerPeer from './video-answer';
 import VideoOfferPeer from './video-offer';
 
@@ -10,6 +10,9 @@ export type {
   KecpRoomOption,
   KecpRoomInternalOption,
   KecpMessage,
+  PeerLink,
+  PeerPlan,
+  RestartNotice,
 } from './types';
 
 export {
@@ -20,6 +23,7 @@ export {
 export {
   KecpSignal,
   KecpRoom,
+  RelayName,
   AnswerPeer,
   VideoOfferPeer,
 };
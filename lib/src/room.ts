@@ -13,6 +13,9 @@ interface KecpRoomEventCallback {
   (evt: Event): void
 }
 
+// The name of the virtual member forwarding the tracks in the rooms with a relay.
+export const RelayName = 'kecp-relay';
+
 export default class KecpRoom {
   private et: EventTarget;
 
@@ -95,6 +98,14 @@ export default class KecpRoom {
         messageEvent = new CustomEvent(KecpEventType.UserLeave, { detail: message.payload });
         this.et.dispatchEvent(messageEvent);
         break;
+      case KecpMessageType.Plan:
+        messageEvent = new CustomEvent(KecpEventType.Plan, { detail: message.payload });
+        this.et.dispatchEvent(messageEvent);
+        break;
+      case KecpMessageType.Restarting:
+        messageEvent = new CustomEvent(KecpEventType.Restarting, { detail: message.payload });
+        this.et.dispatchEvent(messageEvent);
+        break;
       default:
     }
   }
@@ -119,6 +130,10 @@ export default class KecpRoom {
     return undefined;
   }
 
+  newRelayOffer(): VideoOfferPeer {
+    return new VideoOfferPeer(this, this.iceServers, RelayName);
+  }
+
   newDataOffer(target: string): VideoOfferPeer | undefined {
     if (this.userList.includes(target)) {
       return new VideoOfferPeer(this, this.iceServers, target);
@@ -126,6 +141,10 @@ export default class KecpRoom {
     return undefined;
   }
 
+  setIceServers(iceServers: RTCIceServer[]) {
+    this.iceServers = iceServers;
+  }
+
   getSelfName(): string {
     return this.name;
   }
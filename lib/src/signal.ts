@@ -1,8 +1,10 @@
 import axios, { AxiosError } from 'axios';
 import KecpRoom from './room';
 import { genCryptoKey } from './helper';
+import { KecpEventType } from './enums';
 import type {
-  CreateRoomResponse, ErrResponse, KecpRoomOption,
+  CreateRoomResponse, ErrResponse, ICEServersResponse, KecpRoomOption, RTCIceServer,
+  TurnCredentialsResponse,
 } from './types';
 
 export default class KecpSignal {
@@ -24,6 +26,11 @@ export default class KecpSignal {
     this.clientsEndPoint = wsEndPoint.toString();
   }
 
+  private roomsURL(path: string): string {
+    const base = this.roomsEndPoint.endsWith('/') ? this.roomsEndPoint : `${this.roomsEndPoint}/`;
+    return new URL(path, base).toString();
+  }
+
   createRoom(): Promise<string> {
     return axios.post(this.roomsEndPoint, {
       client_key: this.clientKey,
@@ -42,8 +49,35 @@ export default class KecpSignal {
     });
   }
 
+  getIceServers(): Promise<RTCIceServer[]> {
+    return axios.get(this.roomsURL('ice-servers'), {
+      timeout: 8000,
+    }).then((res) => {
+      const iceServersResponse = res.data as ICEServersResponse;
+      return iceServersResponse.ice_servers;
+    });
+  }
+
+  getTurnCredentials(roomID: string): Promise<RTCIceServer[]> {
+    return axios.get(this.roomsURL(`${roomID}/turn-credentials`), {
+      headers: { Authorization: `Bearer ${this.clientKey}` },
+      timeout: 8000,
+    }).then((res) => {
+      const credentials = res.data as TurnCredentialsResponse;
+      const iceServers = credentials.ice_servers ? credentials.ice_servers : [];
+      if (credentials.uris && credentials.uris.length > 0) {
+        iceServers.push({
+          urls: credentials.uris,
+          username: credentials.username,
+          credential: credentials.password,
+        });
+      }
+      return iceServers;
+    });
+  }
+
   getRoom(option: KecpRoomOption): KecpRoom {
-    return new KecpRoom({
+    const room = new KecpRoom({
       websocketURL: this.clientsEndPoint,
       roomID: option.roomID,
       clientKey: this.clientKey,
@@ -51,5 +85,16 @@ export default class KecpSignal {
         urls: 'stun:stun.stunprotocol.org',
       }],
     });
+    if (!option.iceServers) {
+      // Use the ICE servers advertised by the server, and the TURN credentials
+      // which are only given to the members, once joined.
+      room.on(KecpEventType.UserListInit, () => {
+        Promise.all([
+          this.getIceServers(),
+          this.getTurnCredentials(option.roomID).catch(() => []),
+        ]).then(([iceServers, turn]) => room.setIceServers(iceServers.concat(turn))).catch(() => {});
+      });
+    }
+    return room;
   }
 }
@@ -13,6 +13,18 @@ type CreateRoomResponse = {
     room_id: string
 }
 
+type ICEServersResponse = {
+    ice_servers: RTCIceServer[]
+}
+
+type TurnCredentialsResponse = {
+    username?: string
+    password?: string
+    ttl?: number
+    uris?: string[]
+    ice_servers?: RTCIceServer[]
+}
+
 type ErrResponse = {
     status: string
     code: string
@@ -31,6 +43,23 @@ type KecpRoomInternalOption = {
     iceServers: RTCIceServer[]
 }
 
+type PeerLink = {
+    name: string
+    offer: boolean
+    polite: boolean
+    send: boolean
+    receive: boolean
+}
+
+type PeerPlan = {
+    topology: 'mesh' | 'relay-tree'
+    peers: PeerLink[]
+}
+
+type RestartNotice = {
+    reconnect_after: number
+}
+
 type KecpMessage = {
     type: KecpMessageType
     name?: string
@@ -41,8 +70,13 @@ type KecpMessage = {
 export type {
   RTCIceServer,
   CreateRoomResponse,
+  ICEServersResponse,
+  TurnCredentialsResponse,
   ErrResponse,
   KecpRoomOption,
   KecpRoomInternalOption,
   KecpMessage,
+  PeerLink,
+  PeerPlan,
+  RestartNotice,
 };
@@ -34,6 +34,9 @@ export default class Peer {
   }
 
   private async handleNewICECandidateMsg(event: CustomEvent) {
+    if (event.detail.name !== this.target) {
+      return;
+    }
     const candidate = new RTCIceCandidate(event.detail.payload);
     try {
       await this.peerConnection.addIceCandidate(candidate);
@@ -43,6 +46,9 @@ export default class Peer {
   }
 
   private async handleVideoAnswerMsg(event: CustomEvent) {
+    if (event.detail.name !== this.target) {
+      return;
+    }
     const desc = new RTCSessionDescription(event.detail.payload);
     await this.peerConnection.setRemoteDescription(desc);
     if (desc.type === 'answer' && this.bandWidth !== undefined) {
@@ -0,0 +1,144 @@
+package kecpbroker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+)
+
+// RoomTTL is how long a room record outlives the last time its node kept it,
+// so that the rooms of a crashed node are forgotten.
+const RoomTTL = time.Minute
+
+var (
+	ErrRoomNotFound    = errors.New("room not found")
+	ErrBrokerIsClosed  = errors.New("broker is closed")
+	ErrNotAValidRecord = errors.New("not a valid room record")
+)
+
+type EventType string
+
+const (
+	// A message for every member of the room.
+	Broadcast EventType = "broadcast"
+
+	// A message for the member named by the message target.
+	Forward EventType = "forward"
+
+	// A member joined the room on the publishing node.
+	Join EventType = "join"
+
+	// A member left the room on the publishing node.
+	Leave EventType = "leave"
+
+	// The publishing node asks the others to announce their members with join events.
+	Sync EventType = "sync"
+
+	// The settings of the room changed.
+	Update EventType = "update"
+
+	// The room was deleted by its creator.
+	Delete EventType = "delete"
+
+	// The bans, the mutes or the invite uses changed on the publishing node,
+	// or the publishing node tells all of them after a sync.
+	Moderation EventType = "moderation"
+
+	// The moderator removes the member named by the event from the room.
+	Expel EventType = "expel"
+)
+
+// Event is published by a node to the nodes having clients in the same room.
+type Event struct {
+	// The publishing node.
+	Node string `json:"node"`
+
+	Type EventType `json:"type"`
+
+	// The member joining or leaving.
+	Name string `json:"name,omitempty"`
+
+	// The join sequence number of the member joining,
+	// which orders the members on every node.
+	JoinSeq uint64 `json:"join_seq,omitempty"`
+
+	// The hash of the client key of the member joining.
+	KeyHash []byte `json:"key_hash,omitempty"`
+
+	// Whether the member joining lost its connection and may resume.
+	Away bool `json:"away,omitempty"`
+
+	// The message to broadcast or forward.
+	Message *kecpmsg.Message `json:"message,omitempty"`
+
+	// The new room record of an update.
+	Record *RoomRecord `json:"record,omitempty"`
+
+	// The changes to the bans, the mutes and the invite uses of a moderation.
+	Moderation *ModerationState `json:"moderation,omitempty"`
+}
+
+// ModerationState holds the bans, the mutes and the invite uses of a room,
+// or the changes to them. The clients are known by the hashes of their keys.
+type ModerationState struct {
+	BannedNames     []string `json:"banned_names,omitempty"`
+	BannedKeyHashes [][]byte `json:"banned_key_hashes,omitempty"`
+	MutedNames      []string `json:"muted_names,omitempty"`
+	UnmutedNames    []string `json:"unmuted_names,omitempty"`
+
+	// The clients which joined with each invite, by the invite ID.
+	InviteUses map[string][][]byte `json:"invite_uses,omitempty"`
+}
+
+// RoomRecord is what the nodes need to serve a room created on another node.
+// It holds no secret in the clear.
+type RoomRecord struct {
+	RoomID         string           `json:"room_id"`
+	MgtKeyHash     []byte           `json:"mgt_key_hash"`
+	PassphraseSalt []byte           `json:"passphrase_salt,omitempty"`
+	PassphraseHash []byte           `json:"passphrase_hash,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	MaxMembers     int              `json:"max_members,omitempty"`
+	Locked         bool             `json:"locked,omitempty"`
+	InviteOnly     bool             `json:"invite_only,omitempty"`
+	Topology       kecpmsg.Topology `json:"topology,omitempty"`
+	Relay          bool             `json:"relay,omitempty"`
+
+	// The clients which joined with each invite, by the invite ID.
+	InviteUses map[string][][]byte `json:"invite_uses,omitempty"`
+}
+
+// Broker carries the events of the rooms between the nodes,
+// and lets a node find the rooms created on the others.
+//
+// The handlers of a subscription are called one at a time, in the order
+// the events were published, including the events of the subscriber's own node.
+type Broker interface {
+	// Publish sends the event to the subscribers of the room.
+	Publish(roomID string, event *Event) error
+
+	// Subscribe calls the handler with the events of the room
+	// until unsubscribe is called.
+	Subscribe(roomID string, handler func(event *Event)) (unsubscribe func(), err error)
+
+	// PutRoom makes the room known to the other nodes, or updates its record,
+	// for RoomTTL at least.
+	PutRoom(record *RoomRecord) error
+
+	// KeepRoom keeps the record of the room for another RoomTTL,
+	// or returns ErrRoomNotFound if it is already forgotten.
+	KeepRoom(roomID string) error
+
+	// LookupRoom returns the record of the room, or ErrRoomNotFound.
+	LookupRoom(roomID string) (*RoomRecord, error)
+
+	// DeleteRoom forgets the room.
+	DeleteRoom(roomID string) error
+
+	// Ping reports whether the broker can be reached before the context is done.
+	Ping(ctx context.Context) error
+
+	Close() error
+}
@@ -0,0 +1,176 @@
+package kecpbroker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/fourdim/kecp/modules/kecp-broker"
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRedis(t *testing.T) Broker {
+	server := miniredis.RunT(t)
+	broker, err := NewRedis("redis://" + server.Addr())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { broker.Close() })
+	return broker
+}
+
+func newMemory(t *testing.T) Broker {
+	broker := NewMemory()
+	t.Cleanup(func() { broker.Close() })
+	return broker
+}
+
+func readEvent(t *testing.T, events chan *Event) *Event {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(3 * time.Second):
+		t.Fatal("no event")
+	}
+	return nil
+}
+
+func testEvents(t *testing.T, broker Broker) {
+	events := make(chan *Event, 16)
+	unsubscribe, err := broker.Subscribe("room", func(event *Event) {
+		events <- event
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	other := make(chan *Event, 16)
+	unsubscribeOther, err := broker.Subscribe("other", func(event *Event) {
+		other <- event
+	})
+	assert.NoError(t, err)
+	defer unsubscribeOther()
+
+	assert.NoError(t, broker.Publish("room", &Event{Node: "a", Type: Join, Name: "Alice", JoinSeq: 1, KeyHash: []byte{1, 2, 3}}))
+	assert.NoError(t, broker.Publish("room", &Event{Node: "a", Type: Forward, Message: &kecpmsg.Message{
+		Type:    kecpmsg.VideoOffer,
+		Name:    "Alice",
+		Target:  "Bob",
+		Payload: "offer",
+	}}))
+	assert.NoError(t, broker.Publish("room", &Event{Node: "a", Type: Leave, Name: "Alice"}))
+
+	// The events arrive in order.
+	assert.Equal(t, &Event{Node: "a", Type: Join, Name: "Alice", JoinSeq: 1, KeyHash: []byte{1, 2, 3}}, readEvent(t, events))
+	forward := readEvent(t, events)
+	assert.Equal(t, Forward, forward.Type)
+	assert.Equal(t, "Bob", forward.Message.Target)
+	assert.Equal(t, "offer", forward.Message.Payload)
+	assert.Equal(t, Leave, readEvent(t, events).Type)
+	assert.Len(t, other, 0)
+
+	unsubscribe()
+	unsubscribe()
+	assert.NoError(t, broker.Publish("room", &Event{Node: "a", Type: Sync}))
+	select {
+	case <-events:
+		t.Fatal("event after unsubscribe")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func testRooms(t *testing.T, broker Broker) {
+	_, err := broker.LookupRoom("room")
+	assert.ErrorIs(t, err, ErrRoomNotFound)
+	assert.ErrorIs(t, broker.PutRoom(&RoomRecord{}), ErrNotAValidRecord)
+
+	record := &RoomRecord{
+		RoomID:     "room",
+		MgtKeyHash: []byte{1, 2, 3},
+		CreatedAt:  time.Unix(1600000000, 0).UTC(),
+		MaxMembers: 4,
+		Topology:   kecpmsg.RelayTree,
+	}
+	assert.NoError(t, broker.PutRoom(record))
+	found, err := broker.LookupRoom("room")
+	assert.NoError(t, err)
+	assert.Equal(t, record, found)
+
+	assert.NoError(t, broker.KeepRoom("room"))
+	assert.ErrorIs(t, broker.KeepRoom("other"), ErrRoomNotFound)
+
+	record.Locked = true
+	assert.NoError(t, broker.PutRoom(record))
+	found, err = broker.LookupRoom("room")
+	assert.NoError(t, err)
+	assert.True(t, found.Locked)
+
+	assert.NoError(t, broker.DeleteRoom("room"))
+	_, err = broker.LookupRoom("room")
+	assert.ErrorIs(t, err, ErrRoomNotFound)
+}
+
+func TestMemory(t *testing.T) {
+	testEvents(t, newMemory(t))
+	testRooms(t, newMemory(t))
+}
+
+func TestRedis(t *testing.T) {
+	testEvents(t, newRedis(t))
+	testRooms(t, newRedis(t))
+}
+
+func TestRedisRoomTTL(t *testing.T) {
+	server := miniredis.RunT(t)
+	broker, err := NewRedis("redis://" + server.Addr())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer broker.Close()
+	assert.NoError(t, broker.PutRoom(&RoomRecord{RoomID: "room"}))
+	assert.NoError(t, broker.PutRoom(&RoomRecord{RoomID: "crashed"}))
+
+	// Only the kept room outlives its TTL.
+	server.FastForward(RoomTTL / 2)
+	assert.NoError(t, broker.KeepRoom("room"))
+	server.FastForward(RoomTTL / 2)
+	_, err = broker.LookupRoom("room")
+	assert.NoError(t, err)
+	_, err = broker.LookupRoom("crashed")
+	assert.ErrorIs(t, err, ErrRoomNotFound)
+	assert.ErrorIs(t, broker.KeepRoom("crashed"), ErrRoomNotFound)
+}
+
+func TestMemoryClosed(t *testing.T) {
+	broker := NewMemory()
+	unsubscribe, err := broker.Subscribe("room", func(event *Event) {})
+	assert.NoError(t, err)
+	assert.NoError(t, broker.Ping(context.Background()))
+	assert.NoError(t, broker.Close())
+	assert.ErrorIs(t, broker.Ping(context.Background()), ErrBrokerIsClosed)
+	unsubscribe()
+	assert.ErrorIs(t, broker.Publish("room", &Event{Type: Sync}), ErrBrokerIsClosed)
+	_, err = broker.Subscribe("room", func(event *Event) {})
+	assert.ErrorIs(t, err, ErrBrokerIsClosed)
+}
+
+func TestRedisPing(t *testing.T) {
+	server := miniredis.RunT(t)
+	broker, err := NewRedis("redis://" + server.Addr())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer broker.Close()
+	assert.NoError(t, broker.Ping(context.Background()))
+	server.Close()
+	assert.Error(t, broker.Ping(context.Background()))
+}
+
+func TestRedisUnreachable(t *testing.T) {
+	server := miniredis.RunT(t)
+	addr := server.Addr()
+	server.Close()
+	_, err := NewRedis("redis://" + addr)
+	assert.Error(t, err)
+}
@@ -0,0 +1,211 @@
+package kecpbroker
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// Memory is a broker for the nodes living in the same process,
+// which is a single node most of the time.
+// The events are encoded as they would be on the wire.
+type Memory struct {
+	mu sync.Mutex
+
+	rooms map[string][]byte
+
+	subscriptions map[string]map[*subscription]bool
+
+	closed bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		rooms:         make(map[string][]byte),
+		subscriptions: make(map[string]map[*subscription]bool),
+	}
+}
+
+// subscription queues the events without bound, so that
+// the publisher never waits for a busy subscriber.
+type subscription struct {
+	mu      sync.Mutex
+	queue   [][]byte
+	wake    chan struct{}
+	done    chan struct{}
+	handler func(event *Event)
+}
+
+func (s *subscription) push(b []byte) {
+	s.mu.Lock()
+	s.queue = append(s.queue, b)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) pop() ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == 0 {
+		return nil, false
+	}
+	b := s.queue[0]
+	s.queue = s.queue[1:]
+	return b, true
+}
+
+func (s *subscription) run() {
+	for {
+		for b, ok := s.pop(); ok; b, ok = s.pop() {
+			var event Event
+			if err := json.Unmarshal(b, &event); err != nil {
+				continue
+			}
+			s.handler(&event)
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+		}
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (m *Memory) Publish(roomID string, event *Event) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrBrokerIsClosed
+	}
+	for s := range m.subscriptions[roomID] {
+		s.push(b)
+	}
+	return nil
+}
+
+func (m *Memory) Subscribe(roomID string, handler func(event *Event)) (func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrBrokerIsClosed
+	}
+	s := &subscription{
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		handler: handler,
+	}
+	if m.subscriptions[roomID] == nil {
+		m.subscriptions[roomID] = make(map[*subscription]bool)
+	}
+	m.subscriptions[roomID][s] = true
+	go s.run()
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if !m.subscriptions[roomID][s] {
+			return
+		}
+		delete(m.subscriptions[roomID], s)
+		if len(m.subscriptions[roomID]) == 0 {
+			delete(m.subscriptions, roomID)
+		}
+		close(s.done)
+	}, nil
+}
+
+func (m *Memory) PutRoom(record *RoomRecord) error {
+	if record == nil || record.RoomID == "" {
+		return ErrNotAValidRecord
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrBrokerIsClosed
+	}
+	m.rooms[record.RoomID] = b
+	return nil
+}
+
+// KeepRoom only checks the room, as the rooms of the nodes
+// in the same process cannot outlive them.
+func (m *Memory) KeepRoom(roomID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrBrokerIsClosed
+	}
+	if _, ok := m.rooms[roomID]; !ok {
+		return ErrRoomNotFound
+	}
+	return nil
+}
+
+func (m *Memory) LookupRoom(roomID string) (*RoomRecord, error) {
+	m.mu.Lock()
+	b, ok := m.rooms[roomID]
+	closed := m.closed
+	m.mu.Unlock()
+	if closed {
+		return nil, ErrBrokerIsClosed
+	}
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+	var record RoomRecord
+	if err := json.Unmarshal(b, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (m *Memory) DeleteRoom(roomID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrBrokerIsClosed
+	}
+	delete(m.rooms, roomID)
+	return nil
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrBrokerIsClosed
+	}
+	return nil
+}
+
+// Close stops the delivery to every subscription.
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	for _, subscriptions := range m.subscriptions {
+		for s := range subscriptions {
+			close(s.done)
+		}
+	}
+	m.subscriptions = nil
+	return nil
+}
@@ -0,0 +1,25 @@
+package kecpcrypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+)
+
+// GenerateSecret generates a random secret of 32 bytes for SignHmacSha256.
+func GenerateSecret() []byte {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return secret
+}
+
+func SignHmacSha256(secret []byte, content []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(content)
+	return mac.Sum(nil)
+}
+
+// VerifyHmacSha256 reports whether the signature matches the content.
+func VerifyHmacSha256(secret []byte, content []byte, signature []byte) bool {
+	return hmac.Equal(SignHmacSha256(secret, content), signature)
+}
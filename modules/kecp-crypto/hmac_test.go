@@ -0,0 +1,21 @@
+package kecpcrypto_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	. "github.com/fourdim/kecp/modules/kecp-crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateSecret(t *testing.T) {
+	assert.Len(t, GenerateSecret(), 32)
+}
+
+func TestSignHmacSha256(t *testing.T) {
+	// RFC 4231 Test Case 2
+	signature := SignHmacSha256([]byte("Jefe"), []byte("what do ya want for nothing?"))
+	assert.Equal(t, "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843", hex.EncodeToString(signature))
+	assert.True(t, VerifyHmacSha256([]byte("Jefe"), []byte("what do ya want for nothing?"), signature))
+	assert.False(t, VerifyHmacSha256([]byte("Jeff"), []byte("what do ya want for nothing?"), signature))
+}
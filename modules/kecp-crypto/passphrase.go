@@ -0,0 +1,33 @@
+package kecpcrypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// PBKDF2 parameters for hashing the passphrases.
+	passphraseIterations = 100000
+	passphraseHashLength = 32
+	passphraseSaltLength = 16
+)
+
+// GenerateSalt generates a random salt for HashPassphrase.
+func GenerateSalt() []byte {
+	salt := make([]byte, passphraseSaltLength)
+	rand.Read(salt)
+	return salt
+}
+
+// HashPassphrase derives a hash from the passphrase with PBKDF2-HMAC-SHA256.
+func HashPassphrase(passphrase string, salt []byte) []byte {
+	return pbkdf2.Key([]byte(passphrase), salt, passphraseIterations, passphraseHashLength, sha256.New)
+}
+
+// VerifyPassphrase reports whether the passphrase matches the salted hash.
+func VerifyPassphrase(passphrase string, salt []byte, hash []byte) bool {
+	return subtle.ConstantTimeCompare(HashPassphrase(passphrase, salt), hash) == 1
+}
@@ -0,0 +1,22 @@
+package kecpcrypto_test
+
+import (
+	"testing"
+
+	. "github.com/fourdim/kecp/modules/kecp-crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateSalt(t *testing.T) {
+	assert.Len(t, GenerateSalt(), 16)
+	assert.NotEqual(t, GenerateSalt(), GenerateSalt())
+}
+
+func TestVerifyPassphrase(t *testing.T) {
+	salt := GenerateSalt()
+	hash := HashPassphrase("correct horse battery staple", salt)
+	assert.Len(t, hash, 32)
+	assert.True(t, VerifyPassphrase("correct horse battery staple", salt, hash))
+	assert.False(t, VerifyPassphrase("correct horse battery", salt, hash))
+	assert.False(t, VerifyPassphrase("correct horse battery staple", GenerateSalt(), hash))
+}
@@ -1,5 +1,7 @@
 package kecpmsg
 
+import "time"
+
 func NewListMsg(list []string) *Message {
 	return &Message{
 		Type:    List,
@@ -29,3 +31,75 @@ func NewErrorMsg(err error) *Message {
 		Payload: err.Error(),
 	}
 }
+
+func NewPlaybackMsg(name string, state PlaybackState) *Message {
+	return &Message{
+		Type:    Playback,
+		Name:    name,
+		Payload: state,
+	}
+}
+
+func NewClockPongMsg(clientTime float64, receiveTime int64) *Message {
+	return &Message{
+		Type: ClockPong,
+		Payload: ClockSample{
+			ClientTime:  clientTime,
+			ReceiveTime: receiveTime,
+		},
+	}
+}
+
+func NewModerationMsg(moderator string, action MsgType, target string) *Message {
+	return &Message{
+		Type: Moderation,
+		Name: moderator,
+		Payload: ModerationNotice{
+			Action: action,
+			Target: target,
+		},
+	}
+}
+
+func NewSessionMsg(resumeToken string, resumed bool) *Message {
+	return &Message{
+		Type: Session,
+		Payload: SessionInfo{
+			ResumeToken: resumeToken,
+			Resumed:     resumed,
+		},
+	}
+}
+
+// NewLobbyMsg tells a waiting client its 1-based position in the lobby.
+func NewLobbyMsg(position int) *Message {
+	return &Message{
+		Type:    Lobby,
+		Payload: position,
+	}
+}
+
+// NewPlanMsg tells a member which peers to connect to and how.
+func NewPlanMsg(plan PeerPlan) *Message {
+	return &Message{
+		Type:    Plan,
+		Payload: plan,
+	}
+}
+
+// NewLobbyQueueMsg tells the moderator who is waiting in the lobby.
+func NewLobbyQueueMsg(waiting []string) *Message {
+	return &Message{
+		Type:    LobbyQueue,
+		Payload: waiting,
+	}
+}
+
+// NewRestartingMsg tells a client that the server is going down
+// and when to reconnect.
+func NewRestartingMsg(reconnectAfter time.Duration) *Message {
+	return &Message{
+		Type:    Restarting,
+		Payload: RestartNotice{ReconnectAfter: reconnectAfter.Milliseconds()},
+	}
+}
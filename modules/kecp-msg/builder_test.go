@@ -3,6 +3,7 @@ package kecpmsg_test
 import (
 	"errors"
 	"testing"
+	"time"
 
 	. "github.com/fourdim/kecp/modules/kecp-msg"
 	"github.com/stretchr/testify/assert"
@@ -27,3 +28,53 @@ func TestNewErrorMessage(t *testing.T) {
 	msg := NewErrorMsg(errors.New("err"))
 	assert.Equal(t, `{"type":"error","payload":"err"}`, string(msg.Build()))
 }
+
+func TestNewPlaybackMessage(t *testing.T) {
+	msg := NewPlaybackMsg("Alice", PlaybackState{Position: 1.5, Paused: false, Rate: 1, ServerTime: 1000})
+	assert.Equal(t, `{"type":"playback","name":"Alice","payload":{"position":1.5,"paused":false,"rate":1,"server_time":1000}}`, string(msg.Build()))
+}
+
+func TestNewClockPongMessage(t *testing.T) {
+	msg := NewClockPongMsg(100.5, 2000)
+	assert.Equal(t, `{"type":"clock-pong","payload":{"client_time":100.5,"receive_time":2000}}`, string(msg.Build()))
+	assert.Equal(t, `{"type":"clock-pong","payload":{"client_time":100.5,"receive_time":2000},"server_time":2001}`, string(msg.BuildAt(time.UnixMilli(2001))))
+}
+
+func TestBuildAtRelayedMessage(t *testing.T) {
+	msg := &Message{Type: Chat, Name: "Alice", Payload: "Hello"}
+	assert.Equal(t, `{"type":"chat","name":"Alice","payload":"Hello"}`, string(msg.BuildAt(time.UnixMilli(2001))))
+}
+
+func TestNewModerationMessage(t *testing.T) {
+	msg := NewModerationMsg("Alice", Kick, "Mallory")
+	assert.Equal(t, `{"type":"moderation","name":"Alice","payload":{"action":"kick","target":"Mallory"}}`, string(msg.Build()))
+}
+
+func TestNewSessionMessage(t *testing.T) {
+	msg := NewSessionMsg("token", true)
+	assert.Equal(t, `{"type":"session","payload":{"resume_token":"token","resumed":true}}`, string(msg.Build()))
+}
+
+func TestNewLobbyMessage(t *testing.T) {
+	msg := NewLobbyMsg(2)
+	assert.Equal(t, `{"type":"lobby","payload":2}`, string(msg.Build()))
+}
+
+func TestNewLobbyQueueMessage(t *testing.T) {
+	msg := NewLobbyQueueMsg([]string{"Alice", "Bob"})
+	assert.Equal(t, `{"type":"lobby-queue","payload":["Alice","Bob"]}`, string(msg.Build()))
+}
+
+func TestNewPlanMessage(t *testing.T) {
+	msg := NewPlanMsg(PeerPlan{
+		Topology: Mesh,
+		Peers:    []PeerLink{{Name: "Bob", Offer: true, Send: true, Receive: true}},
+	})
+	assert.Equal(t, `{"type":"plan","payload":{"topology":"mesh","peers":[{"name":"Bob","offer":true,"polite":false,"send":true,"receive":true}]}}`, string(msg.Build()))
+}
+
+func TestNewRestartingMessage(t *testing.T) {
+	msg := NewRestartingMsg(5 * time.Second)
+	assert.True(t, msg.IsFromServer())
+	assert.Equal(t, `{"type":"server-restarting","payload":{"reconnect_after":5000}}`, string(msg.Build()))
+}
@@ -3,6 +3,7 @@ package kecpmsg
 import (
 	"encoding/json"
 	"errors"
+	"time"
 )
 
 type MsgType string
@@ -20,14 +21,121 @@ type Message struct {
 	// The message's payload.
 	Payload interface{} `json:"payload"`
 
+	// The server time in unix milliseconds when a server-originated
+	// message was written to the connection.
+	ServerTime int64 `json:"server_time,omitempty"`
+
 	// Broadcast except the client with clientKey.
 	ExceptClientKey string `json:"-"`
 }
 
+// PlaybackState is the room's authoritative playback state.
+type PlaybackState struct {
+	// The media position in seconds at ServerTime.
+	Position float64 `json:"position"`
+
+	// Whether the media is paused.
+	Paused bool `json:"paused"`
+
+	// The playback rate.
+	Rate float64 `json:"rate"`
+
+	// The server time in unix milliseconds when the state was taken.
+	ServerTime int64 `json:"server_time"`
+}
+
+// ClockSample is the payload of a clock-pong message.
+//
+// With t0 = ClientTime, t1 = ReceiveTime, t2 = Message.ServerTime and t3 the
+// client time when the pong arrives, the client estimates
+// offset = ((t1 - t0) + (t2 - t3)) / 2 and round trip = (t3 - t0) - (t2 - t1).
+type ClockSample struct {
+	// The client time echoed from the clock-ping message.
+	ClientTime float64 `json:"client_time"`
+
+	// The server time in unix milliseconds when the clock-ping was read.
+	ReceiveTime int64 `json:"receive_time"`
+}
+
+// BanTarget is the payload of a ban message.
+// At least one of the fields is set.
+type BanTarget struct {
+	Name      string `json:"name,omitempty"`
+	ClientKey string `json:"client_key,omitempty"`
+}
+
+// ModerationNotice is the payload of a moderation message.
+type ModerationNotice struct {
+	// The moderator command applied.
+	Action MsgType `json:"action"`
+
+	// The username of the person affected.
+	Target string `json:"target,omitempty"`
+}
+
+// SessionInfo is the payload of a session message.
+type SessionInfo struct {
+	// The token to present on auth to resume the session after a disconnection.
+	ResumeToken string `json:"resume_token"`
+
+	// Whether a previous session was resumed.
+	Resumed bool `json:"resumed"`
+}
+
+// Topology is the shape of the peer connections in a room.
+type Topology string
+
+const (
+	// Every member connects to every other member.
+	Mesh Topology = "mesh"
+
+	// The members form a tree rooted at the streaming member,
+	// each member re-broadcasting to its children.
+	RelayTree Topology = "relay-tree"
+)
+
+func (topology Topology) IsValid() bool {
+	return topology == Mesh || topology == RelayTree
+}
+
+// PeerLink is a peer connection a member is planned to have.
+type PeerLink struct {
+	// The username of the peer.
+	Name string `json:"name"`
+
+	// Whether the member makes the offer, the peer waits for it otherwise.
+	Offer bool `json:"offer"`
+
+	// Whether the member gives way to the peer's offer on glare.
+	Polite bool `json:"polite"`
+
+	// Whether the member sends its media, or the media it receives, to the peer.
+	Send bool `json:"send"`
+
+	// Whether the member receives the media from the peer.
+	Receive bool `json:"receive"`
+}
+
+// PeerPlan is the payload of a plan message.
+type PeerPlan struct {
+	Topology Topology   `json:"topology"`
+	Peers    []PeerLink `json:"peers"`
+}
+
+// RestartNotice is the payload of a server-restarting message.
+type RestartNotice struct {
+	// The suggested delay in milliseconds before reconnecting
+	// with the resume token.
+	ReconnectAfter int64 `json:"reconnect_after"`
+}
+
 type AuthMessage struct {
-	RoomID    string `json:"room_id"`
-	Name      string `json:"name"`
-	ClientKey string `json:"client_key"`
+	RoomID      string `json:"room_id"`
+	Name        string `json:"name"`
+	ClientKey   string `json:"client_key"`
+	ResumeToken string `json:"resume_token,omitempty"`
+	Passphrase  string `json:"passphrase,omitempty"`
+	Invite      string `json:"invite,omitempty"`
 }
 
 const (
@@ -39,8 +147,37 @@ const (
 	Join            MsgType = "join"
 	Leave           MsgType = "leave"
 	Error           MsgType = "error"
+	Play            MsgType = "play"
+	Pause           MsgType = "pause"
+	Seek            MsgType = "seek"
+	RateChange      MsgType = "rate-change"
+	Playback        MsgType = "playback"
+	ClockPing       MsgType = "clock-ping"
+	ClockPong       MsgType = "clock-pong"
+	Kick            MsgType = "kick"
+	Ban             MsgType = "ban"
+	Mute            MsgType = "mute"
+	Unmute          MsgType = "unmute"
+	Moderation      MsgType = "moderation"
+	Session         MsgType = "session"
+	Admit           MsgType = "admit"
+	Reject          MsgType = "reject"
+	Lobby           MsgType = "lobby"
+	LobbyQueue      MsgType = "lobby-queue"
+	Plan            MsgType = "plan"
+	Restarting      MsgType = "server-restarting"
 )
 
+const (
+	// The playback rate bounds accepted from the clients.
+	MinPlaybackRate = 0.0625
+	MaxPlaybackRate = 16
+)
+
+// RelayName is the name of the virtual member forwarding the tracks
+// in the rooms with a relay. No client can take it.
+const RelayName = "kecp-relay"
+
 var (
 	ErrCanNotParseMessage = errors.New("can not prase the message")
 )
@@ -60,7 +197,64 @@ func Parse(msg []byte, name string) (*Message, error) {
 	case Join:
 		fallthrough
 	case Leave:
+		fallthrough
+	case Playback:
+		fallthrough
+	case ClockPong:
+		fallthrough
+	case Moderation:
+		fallthrough
+	case Session:
+		fallthrough
+	case Lobby:
+		fallthrough
+	case LobbyQueue:
+		fallthrough
+	case Plan:
+		fallthrough
+	case Restarting:
 		return nil, ErrCanNotParseMessage
+	case Kick:
+		fallthrough
+	case Mute:
+		fallthrough
+	case Unmute:
+		fallthrough
+	case Admit:
+		fallthrough
+	case Reject:
+		// The payload is the username of the target.
+		target, ok := kecpMsg.Payload.(string)
+		if !ok || target == "" {
+			return nil, ErrCanNotParseMessage
+		}
+	case Ban:
+		target, ok := parseBanTarget(kecpMsg.Payload)
+		if !ok {
+			return nil, ErrCanNotParseMessage
+		}
+		kecpMsg.Payload = target
+	case ClockPing:
+		// The payload is the client time.
+		if _, ok := kecpMsg.Payload.(float64); !ok {
+			return nil, ErrCanNotParseMessage
+		}
+	case Play:
+		fallthrough
+	case Pause:
+		fallthrough
+	case Seek:
+		// The payload is the position in seconds.
+		position, ok := kecpMsg.Payload.(float64)
+		if !ok || position < 0 {
+			return nil, ErrCanNotParseMessage
+		}
+	case RateChange:
+		// The payload is the playback rate.
+		rate, ok := kecpMsg.Payload.(float64)
+		if !ok || rate < MinPlaybackRate || rate > MaxPlaybackRate {
+			return nil, ErrCanNotParseMessage
+		}
 	}
 	return &kecpMsg, nil
 }
@@ -89,7 +283,107 @@ func (kecpMsg *Message) NeedBroadcast() bool {
 	}
 }
 
+func parseBanTarget(payload interface{}) (BanTarget, bool) {
+	var target BanTarget
+	fields, ok := payload.(map[string]interface{})
+	if !ok {
+		return target, false
+	}
+	if name, ok := fields["name"]; ok {
+		if target.Name, ok = name.(string); !ok {
+			return target, false
+		}
+	}
+	if clientKey, ok := fields["client_key"]; ok {
+		if target.ClientKey, ok = clientKey.(string); !ok {
+			return target, false
+		}
+	}
+	return target, target.Name != "" || target.ClientKey != ""
+}
+
+// IsModeration reports whether the message is a moderator command.
+func (kecpMsg *Message) IsModeration() bool {
+	switch kecpMsg.Type {
+	case Kick:
+		fallthrough
+	case Ban:
+		fallthrough
+	case Mute:
+		fallthrough
+	case Unmute:
+		fallthrough
+	case Admit:
+		fallthrough
+	case Reject:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsPlaybackControl reports whether the message changes the room's playback state.
+func (kecpMsg *Message) IsPlaybackControl() bool {
+	switch kecpMsg.Type {
+	case Play:
+		fallthrough
+	case Pause:
+		fallthrough
+	case Seek:
+		fallthrough
+	case RateChange:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsFromServer reports whether the message is originated by the server
+// rather than relayed from a client.
+func (kecpMsg *Message) IsFromServer() bool {
+	switch kecpMsg.Type {
+	case List:
+		fallthrough
+	case Join:
+		fallthrough
+	case Leave:
+		fallthrough
+	case Error:
+		fallthrough
+	case Playback:
+		fallthrough
+	case ClockPong:
+		fallthrough
+	case Moderation:
+		fallthrough
+	case Session:
+		fallthrough
+	case Lobby:
+		fallthrough
+	case LobbyQueue:
+		fallthrough
+	case Plan:
+		fallthrough
+	case Restarting:
+		return true
+	default:
+		return false
+	}
+}
+
 func (kecpMsg *Message) Build() []byte {
 	b, _ := json.Marshal(kecpMsg)
 	return b
 }
+
+// BuildAt builds the message, stamping it with the server time
+// if it is originated by the server.
+// The message itself is left untouched since it may be shared by several clients.
+func (kecpMsg *Message) BuildAt(serverTime time.Time) []byte {
+	if !kecpMsg.IsFromServer() {
+		return kecpMsg.Build()
+	}
+	stamped := *kecpMsg
+	stamped.ServerTime = serverTime.UnixMilli()
+	return stamped.Build()
+}
@@ -66,3 +66,102 @@ func TestParseFraudMessage(t *testing.T) {
 	_, err := Parse([]byte(`{"type":"chat","name":"Alice","target":"Bob","payload":"Hello"}`), "Mallory")
 	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
 }
+
+func TestParsePlayMessage(t *testing.T) {
+	msg, err := Parse([]byte(`{"type":"play","name":"Alice","payload":12.5}`), "Alice")
+	assert.NoError(t, err)
+	assert.True(t, msg.IsPlaybackControl())
+	assert.Equal(t, 12.5, msg.Payload)
+}
+
+func TestParseSeekMessageWithNegativePosition(t *testing.T) {
+	_, err := Parse([]byte(`{"type":"seek","name":"Alice","payload":-1}`), "Alice")
+	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
+}
+
+func TestParsePauseMessageWithoutPosition(t *testing.T) {
+	_, err := Parse([]byte(`{"type":"pause","name":"Alice","payload":"now"}`), "Alice")
+	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
+}
+
+func TestParseRateChangeMessage(t *testing.T) {
+	msg, err := Parse([]byte(`{"type":"rate-change","name":"Alice","payload":1.25}`), "Alice")
+	assert.NoError(t, err)
+	assert.True(t, msg.IsPlaybackControl())
+	_, err = Parse([]byte(`{"type":"rate-change","name":"Alice","payload":0}`), "Alice")
+	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
+}
+
+func TestParsePlaybackMessage(t *testing.T) {
+	_, err := Parse([]byte(`{"type":"playback","name":"Mallory","payload":{"position":0}}`), "Mallory")
+	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
+}
+
+func TestParseClockPingMessage(t *testing.T) {
+	msg, err := Parse([]byte(`{"type":"clock-ping","name":"Alice","payload":1656000000000.25}`), "Alice")
+	assert.NoError(t, err)
+	assert.Equal(t, ClockPing, msg.Type)
+	_, err = Parse([]byte(`{"type":"clock-ping","name":"Alice"}`), "Alice")
+	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
+}
+
+func TestParseClockPongMessage(t *testing.T) {
+	_, err := Parse([]byte(`{"type":"clock-pong","name":"Mallory","payload":{"client_time":0,"receive_time":0}}`), "Mallory")
+	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
+}
+
+func TestParseKickMessage(t *testing.T) {
+	msg, err := Parse([]byte(`{"type":"kick","name":"Alice","payload":"Mallory"}`), "Alice")
+	assert.NoError(t, err)
+	assert.True(t, msg.IsModeration())
+	_, err = Parse([]byte(`{"type":"mute","name":"Alice","payload":""}`), "Alice")
+	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
+}
+
+func TestParseBanMessage(t *testing.T) {
+	msg, err := Parse([]byte(`{"type":"ban","name":"Alice","payload":{"name":"Mallory"}}`), "Alice")
+	assert.NoError(t, err)
+	assert.True(t, msg.IsModeration())
+	assert.Equal(t, BanTarget{Name: "Mallory"}, msg.Payload)
+	_, err = Parse([]byte(`{"type":"ban","name":"Alice","payload":{}}`), "Alice")
+	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
+	_, err = Parse([]byte(`{"type":"ban","name":"Alice","payload":{"client_key":1}}`), "Alice")
+	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
+}
+
+func TestParseModerationMessage(t *testing.T) {
+	_, err := Parse([]byte(`{"type":"moderation","name":"Mallory","payload":{"action":"kick","target":"Alice"}}`), "Mallory")
+	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
+}
+
+func TestParseSessionMessage(t *testing.T) {
+	_, err := Parse([]byte(`{"type":"session","name":"Mallory","payload":{"resume_token":"token"}}`), "Mallory")
+	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
+}
+
+func TestParseAdmitMessage(t *testing.T) {
+	msg, err := Parse([]byte(`{"type":"admit","name":"Alice","payload":"Bob"}`), "Alice")
+	assert.NoError(t, err)
+	assert.True(t, msg.IsModeration())
+}
+
+func TestParseLobbyMessage(t *testing.T) {
+	_, err := Parse([]byte(`{"type":"lobby","name":"Mallory","payload":1}`), "Mallory")
+	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
+}
+
+func TestParsePlanMessage(t *testing.T) {
+	_, err := Parse([]byte(`{"type":"plan","name":"Mallory","payload":{"topology":"mesh","peers":[]}}`), "Mallory")
+	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
+}
+
+func TestParseRestartingMessage(t *testing.T) {
+	_, err := Parse([]byte(`{"type":"server-restarting","name":"Mallory","payload":{"reconnect_after":0}}`), "Mallory")
+	assert.EqualError(t, err, ErrCanNotParseMessage.Error())
+}
+
+func TestTopology(t *testing.T) {
+	assert.True(t, Mesh.IsValid())
+	assert.True(t, RelayTree.IsValid())
+	assert.False(t, Topology("star").IsValid())
+}
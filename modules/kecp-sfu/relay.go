@@ -0,0 +1,497 @@
+package kecpsfu
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	kecpturn "github.com/fourdim/kecp/modules/kecp-turn"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// Maximum number of messages waiting to be handled by the relay.
+	maxPendingMessages = 256
+)
+
+var (
+	ErrRelayIsClosed = errors.New("relay is closed")
+	ErrRelayIsBusy   = errors.New("relay is busy")
+)
+
+type Config struct {
+	// The ICE servers the relay gathers its candidates with.
+	ICEServers []kecpturn.ICEServer
+}
+
+func (config *Config) configuration() webrtc.Configuration {
+	iceServers := make([]webrtc.ICEServer, 0, len(config.ICEServers))
+	for _, iceServer := range config.ICEServers {
+		iceServers = append(iceServers, webrtc.ICEServer{
+			URLs:       iceServer.URLs,
+			Username:   iceServer.Username,
+			Credential: iceServer.Credential,
+		})
+	}
+	return webrtc.Configuration{ICEServers: iceServers}
+}
+
+// Relay takes part in a room as a virtual member named kecpmsg.RelayName.
+// The members offer their tracks to the relay, which offers them to
+// every other member in turn, so that a streaming member uploads once.
+//
+// The relay trickles its candidates in new-ice-candidate messages
+// following its descriptions.
+type Relay struct {
+	api           *webrtc.API
+	configuration webrtc.Configuration
+
+	// Delivers the messages from the relay to the members.
+	// Called by one goroutine, in order. May block until the relay is closed.
+	send func(message *kecpmsg.Message)
+
+	// Buffered channel of inbound messages.
+	inbox chan *kecpmsg.Message
+
+	// Buffered channel of outbound messages, in order.
+	outbox chan *kecpmsg.Message
+
+	// Candidates gathered by the peer connections.
+	candidates chan *localCandidate
+
+	// Tracks published by the members.
+	published chan *track
+
+	// Tracks whose publisher is gone.
+	unpublished chan *track
+
+	// The peer connections receiving the tracks of each member.
+	// Only the run goroutine can access it.
+	publishers map[string]*peer
+
+	// The peer connections sending the tracks to each member.
+	// Only the run goroutine can access it.
+	subscribers map[string]*peer
+
+	// The tracks currently forwarded.
+	// Only the run goroutine can access it.
+	tracks map[*track]bool
+
+	done chan struct{}
+}
+
+type peer struct {
+	name string
+	pc   *webrtc.PeerConnection
+
+	// The senders of the forwarded tracks, for the subscribers.
+	senders map[*track]*webrtc.RTPSender
+
+	// Candidates received before the remote description.
+	pendingCandidates []webrtc.ICECandidateInit
+
+	// Whether the tracks changed while an offer was pending.
+	needsRenegotiation bool
+}
+
+type localCandidate struct {
+	peer      *peer
+	candidate *webrtc.ICECandidate
+}
+
+type track struct {
+	publisher *peer
+	local     *webrtc.TrackLocalStaticRTP
+	ssrc      webrtc.SSRC
+}
+
+// New starts a relay which sends its messages with the given function.
+func New(config Config, send func(message *kecpmsg.Message)) *Relay {
+	relay := &Relay{
+		api:           webrtc.NewAPI(webrtc.WithMediaEngine(defaultMediaEngine())),
+		configuration: config.configuration(),
+		send:          send,
+		inbox:         make(chan *kecpmsg.Message, maxPendingMessages),
+		outbox:        make(chan *kecpmsg.Message, maxPendingMessages),
+		candidates:    make(chan *localCandidate),
+		published:     make(chan *track),
+		unpublished:   make(chan *track),
+		publishers:    make(map[string]*peer),
+		subscribers:   make(map[string]*peer),
+		tracks:        make(map[*track]bool),
+		done:          make(chan struct{}),
+	}
+	go relay.run()
+	go relay.deliver()
+	return relay
+}
+
+func defaultMediaEngine() *webrtc.MediaEngine {
+	mediaEngine := &webrtc.MediaEngine{}
+	mediaEngine.RegisterDefaultCodecs()
+	return mediaEngine
+}
+
+// Write hands a message over to the relay without blocking.
+// The join and leave messages tell the relay about the members.
+// The message is dropped with ErrRelayIsBusy if too many are waiting.
+func (relay *Relay) Write(message *kecpmsg.Message) error {
+	select {
+	case <-relay.done:
+		return ErrRelayIsClosed
+	default:
+	}
+	select {
+	case relay.inbox <- message:
+		return nil
+	default:
+		return ErrRelayIsBusy
+	}
+}
+
+// Close closes all the peer connections.
+func (relay *Relay) Close() {
+	select {
+	case <-relay.done:
+	default:
+		close(relay.done)
+	}
+}
+
+func (relay *Relay) run() {
+	defer func() {
+		for _, p := range relay.publishers {
+			p.pc.Close()
+		}
+		for _, p := range relay.subscribers {
+			p.pc.Close()
+		}
+	}()
+	for {
+		select {
+		case message := <-relay.inbox:
+			relay.handle(message)
+		case t := <-relay.published:
+			if relay.publishers[t.publisher.name] != t.publisher {
+				break
+			}
+			relay.tracks[t] = true
+			for name, subscriber := range relay.subscribers {
+				if name != t.publisher.name {
+					relay.subscribe(subscriber, t)
+					relay.negotiate(subscriber)
+				}
+			}
+		case t := <-relay.unpublished:
+			relay.unpublish(t)
+		case c := <-relay.candidates:
+			relay.sendCandidate(c)
+		case <-relay.done:
+			return
+		}
+	}
+}
+
+// deliver sends the messages of the outbox in order.
+func (relay *Relay) deliver() {
+	for {
+		select {
+		case message := <-relay.outbox:
+			relay.send(message)
+		case <-relay.done:
+			return
+		}
+	}
+}
+
+// queue hands the message over to the deliver goroutine.
+// Only the run goroutine can call it.
+func (relay *Relay) queue(message *kecpmsg.Message) {
+	select {
+	case relay.outbox <- message:
+	case <-relay.done:
+	}
+}
+
+func (relay *Relay) handle(message *kecpmsg.Message) {
+	switch message.Type {
+	case kecpmsg.Join:
+		name, _ := message.Payload.(string)
+		relay.leave(name)
+		relay.join(name)
+	case kecpmsg.Leave:
+		name, _ := message.Payload.(string)
+		relay.leave(name)
+	case kecpmsg.VideoOffer:
+		var offer webrtc.SessionDescription
+		if decodePayload(message, &offer) != nil || offer.Type != webrtc.SDPTypeOffer {
+			return
+		}
+		relay.answer(message.Name, offer)
+	case kecpmsg.VideoAnswer:
+		var answer webrtc.SessionDescription
+		if decodePayload(message, &answer) != nil || answer.Type != webrtc.SDPTypeAnswer {
+			return
+		}
+		subscriber, ok := relay.subscribers[message.Name]
+		if !ok || subscriber.pc.SignalingState() != webrtc.SignalingStateHaveLocalOffer {
+			return
+		}
+		if subscriber.pc.SetRemoteDescription(answer) != nil {
+			return
+		}
+		subscriber.addPendingCandidates()
+		if subscriber.needsRenegotiation {
+			subscriber.needsRenegotiation = false
+			relay.negotiate(subscriber)
+		}
+	case kecpmsg.NewIceCandidate:
+		var candidate webrtc.ICECandidateInit
+		if decodePayload(message, &candidate) != nil {
+			return
+		}
+		// The members use one connection to publish and another to subscribe,
+		// tell them apart by the username fragment.
+		for _, p := range []*peer{relay.publishers[message.Name], relay.subscribers[message.Name]} {
+			if p != nil && p.ownsCandidate(candidate) {
+				p.addCandidate(candidate)
+			}
+		}
+	}
+}
+
+func decodePayload(message *kecpmsg.Message, v any) error {
+	b, err := json.Marshal(message.Payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// join prepares the connection sending the forwarded tracks to the member.
+func (relay *Relay) join(name string) {
+	pc, err := relay.api.NewPeerConnection(relay.configuration)
+	if err != nil {
+		return
+	}
+	subscriber := &peer{name: name, pc: pc, senders: make(map[*track]*webrtc.RTPSender)}
+	relay.subscribers[name] = subscriber
+	relay.trickle(subscriber)
+	for t := range relay.tracks {
+		if t.publisher.name != name {
+			relay.subscribe(subscriber, t)
+		}
+	}
+	if len(subscriber.senders) > 0 {
+		relay.negotiate(subscriber)
+	}
+}
+
+// leave closes the connections of the member and stops forwarding its tracks.
+func (relay *Relay) leave(name string) {
+	if publisher, ok := relay.publishers[name]; ok {
+		delete(relay.publishers, name)
+		publisher.pc.Close()
+		for t := range relay.tracks {
+			if t.publisher == publisher {
+				relay.unpublish(t)
+			}
+		}
+	}
+	if subscriber, ok := relay.subscribers[name]; ok {
+		delete(relay.subscribers, name)
+		subscriber.pc.Close()
+	}
+}
+
+// answer accepts the tracks offered by the member.
+func (relay *Relay) answer(name string, offer webrtc.SessionDescription) {
+	publisher, ok := relay.publishers[name]
+	if !ok {
+		pc, err := relay.api.NewPeerConnection(relay.configuration)
+		if err != nil {
+			return
+		}
+		publisher = &peer{name: name, pc: pc}
+		relay.publishers[name] = publisher
+		relay.trickle(publisher)
+		pc.OnTrack(func(remote *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+			relay.forward(publisher, remote)
+		})
+	}
+	if publisher.pc.SetRemoteDescription(offer) != nil {
+		return
+	}
+	publisher.addPendingCandidates()
+	answer, err := publisher.pc.CreateAnswer(nil)
+	if err != nil {
+		return
+	}
+	if publisher.pc.SetLocalDescription(answer) != nil {
+		return
+	}
+	relay.sendDescription(kecpmsg.VideoAnswer, name, publisher.pc.LocalDescription())
+}
+
+// forward copies the packets of the remote track to a local track
+// which the subscribers share, until the publisher stops.
+func (relay *Relay) forward(publisher *peer, remote *webrtc.TrackRemote) {
+	local, err := webrtc.NewTrackLocalStaticRTP(remote.Codec().RTPCodecCapability, remote.ID(), remote.StreamID())
+	if err != nil {
+		return
+	}
+	t := &track{publisher: publisher, local: local, ssrc: remote.SSRC()}
+	select {
+	case relay.published <- t:
+	case <-relay.done:
+		return
+	}
+	defer func() {
+		select {
+		case relay.unpublished <- t:
+		case <-relay.done:
+		}
+	}()
+	for {
+		packet, _, err := remote.ReadRTP()
+		if err != nil {
+			return
+		}
+		if err := local.WriteRTP(packet); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			return
+		}
+	}
+}
+
+func (relay *Relay) unpublish(t *track) {
+	if !relay.tracks[t] {
+		return
+	}
+	delete(relay.tracks, t)
+	for _, subscriber := range relay.subscribers {
+		if sender, ok := subscriber.senders[t]; ok {
+			delete(subscriber.senders, t)
+			subscriber.pc.RemoveTrack(sender)
+			relay.negotiate(subscriber)
+		}
+	}
+}
+
+// subscribe adds the track to the subscriber's connection.
+func (relay *Relay) subscribe(subscriber *peer, t *track) {
+	sender, err := subscriber.pc.AddTrack(t.local)
+	if err != nil {
+		return
+	}
+	subscriber.senders[t] = sender
+	go func() {
+		// Read the RTCP packets for the interceptors to work.
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	// Ask for a key frame, so that the new subscriber can start decoding.
+	t.publisher.pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(t.ssrc)}})
+}
+
+// negotiate offers the current tracks to the subscriber, or waits
+// for the answer to the pending offer before it.
+func (relay *Relay) negotiate(subscriber *peer) {
+	if subscriber.pc.SignalingState() != webrtc.SignalingStateStable {
+		subscriber.needsRenegotiation = true
+		return
+	}
+	offer, err := subscriber.pc.CreateOffer(nil)
+	if err != nil {
+		return
+	}
+	if subscriber.pc.SetLocalDescription(offer) != nil {
+		return
+	}
+	relay.sendDescription(kecpmsg.VideoOffer, subscriber.name, subscriber.pc.LocalDescription())
+}
+
+// trickle hands the candidates gathered by the peer connection over to
+// the run goroutine, which sends them after the description.
+func (relay *Relay) trickle(p *peer) {
+	p.pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		// Closing the peer connection waits for the callback to return,
+		// and the order of the candidates does not matter.
+		go func() {
+			select {
+			case relay.candidates <- &localCandidate{peer: p, candidate: candidate}:
+			case <-relay.done:
+			}
+		}()
+	})
+}
+
+// sendCandidate sends the candidate to the member, unless its
+// peer connection is gone.
+func (relay *Relay) sendCandidate(c *localCandidate) {
+	p := c.peer
+	if relay.publishers[p.name] != p && relay.subscribers[p.name] != p {
+		return
+	}
+	init := c.candidate.ToJSON()
+	// The media are bundled, the candidate belongs to the first one.
+	init.SDPMid = nil
+	for _, transceiver := range p.pc.GetTransceivers() {
+		if mid := transceiver.Mid(); mid != "" {
+			init.SDPMid = &mid
+			break
+		}
+	}
+	relay.queue(&kecpmsg.Message{
+		Type:    kecpmsg.NewIceCandidate,
+		Name:    kecpmsg.RelayName,
+		Target:  p.name,
+		Payload: init,
+	})
+}
+
+func (relay *Relay) sendDescription(msgType kecpmsg.MsgType, target string, desc *webrtc.SessionDescription) {
+	relay.queue(&kecpmsg.Message{
+		Type:    msgType,
+		Name:    kecpmsg.RelayName,
+		Target:  target,
+		Payload: desc,
+	})
+}
+
+// ownsCandidate reports whether the candidate may belong to the connection.
+func (p *peer) ownsCandidate(candidate webrtc.ICECandidateInit) bool {
+	if candidate.UsernameFragment == nil || *candidate.UsernameFragment == "" {
+		return true
+	}
+	desc := p.pc.RemoteDescription()
+	if desc == nil {
+		// The fragment cannot be checked yet.
+		return true
+	}
+	return strings.Contains(desc.SDP, "a=ice-ufrag:"+*candidate.UsernameFragment+"\r\n")
+}
+
+func (p *peer) addCandidate(candidate webrtc.ICECandidateInit) {
+	if p.pc.RemoteDescription() == nil {
+		p.pendingCandidates = append(p.pendingCandidates, candidate)
+		return
+	}
+	p.pc.AddICECandidate(candidate)
+}
+
+func (p *peer) addPendingCandidates() {
+	for _, candidate := range p.pendingCandidates {
+		p.pc.AddICECandidate(candidate)
+	}
+	p.pendingCandidates = nil
+}
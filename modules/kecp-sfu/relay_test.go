@@ -0,0 +1,173 @@
+package kecpsfu_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-sfu"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/stretchr/testify/assert"
+)
+
+// mailboxes collects the messages sent by the relay to each member,
+// with the candidates apart.
+type mailboxes struct {
+	mu    sync.Mutex
+	boxes map[string]chan *kecpmsg.Message
+}
+
+func (m *mailboxes) box(name string) chan *kecpmsg.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.boxes == nil {
+		m.boxes = make(map[string]chan *kecpmsg.Message)
+	}
+	if _, ok := m.boxes[name]; !ok {
+		m.boxes[name] = make(chan *kecpmsg.Message, 64)
+	}
+	return m.boxes[name]
+}
+
+func (m *mailboxes) send(message *kecpmsg.Message) {
+	if message.Type == kecpmsg.NewIceCandidate {
+		m.box(message.Target + " candidates") <- message
+		return
+	}
+	m.box(message.Target) <- message
+}
+
+// trickle adds the candidates sent by the relay to the member to the
+// connection, until done is closed. The first one is awaited.
+func (m *mailboxes) trickle(t *testing.T, name string, pc *webrtc.PeerConnection, done chan struct{}) {
+	box := m.box(name + " candidates")
+	select {
+	case message := <-box:
+		assert.Equal(t, kecpmsg.RelayName, message.Name)
+		assert.NoError(t, pc.AddICECandidate(candidateOf(message)))
+	case <-time.After(10 * time.Second):
+		t.Fatalf("no candidate from the relay for %s", name)
+	}
+	go func() {
+		for {
+			select {
+			case message := <-box:
+				pc.AddICECandidate(candidateOf(message))
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+func candidateOf(message *kecpmsg.Message) webrtc.ICECandidateInit {
+	b, _ := json.Marshal(message.Payload)
+	var candidate webrtc.ICECandidateInit
+	json.Unmarshal(b, &candidate)
+	return candidate
+}
+
+func readDescription(t *testing.T, box chan *kecpmsg.Message, msgType kecpmsg.MsgType) webrtc.SessionDescription {
+	select {
+	case message := <-box:
+		assert.Equal(t, msgType, message.Type)
+		assert.Equal(t, kecpmsg.RelayName, message.Name)
+		b, _ := json.Marshal(message.Payload)
+		var desc webrtc.SessionDescription
+		assert.NoError(t, json.Unmarshal(b, &desc))
+		return desc
+	case <-time.After(10 * time.Second):
+		t.Fatalf("no %s from the relay", msgType)
+	}
+	return webrtc.SessionDescription{}
+}
+
+func localDescription(t *testing.T, pc *webrtc.PeerConnection, desc webrtc.SessionDescription) *webrtc.SessionDescription {
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	assert.NoError(t, pc.SetLocalDescription(desc))
+	<-gatherComplete
+	return pc.LocalDescription()
+}
+
+func TestRelay(t *testing.T) {
+	m := &mailboxes{}
+	relay := New(Config{}, m.send)
+	defer relay.Close()
+	assert.NoError(t, relay.Write(kecpmsg.NewJoinMsg("Alice", "")))
+	assert.NoError(t, relay.Write(kecpmsg.NewJoinMsg("Bob", "")))
+
+	// Alice offers a video track to the relay.
+	alice, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	defer alice.Close()
+	video, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "alice")
+	assert.NoError(t, err)
+	_, err = alice.AddTrack(video)
+	assert.NoError(t, err)
+	offer, err := alice.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, relay.Write(&kecpmsg.Message{
+		Type:    kecpmsg.VideoOffer,
+		Name:    "Alice",
+		Target:  kecpmsg.RelayName,
+		Payload: localDescription(t, alice, offer),
+	}))
+	assert.NoError(t, alice.SetRemoteDescription(readDescription(t, m.box("Alice"), kecpmsg.VideoAnswer)))
+	done := make(chan struct{})
+	defer close(done)
+	m.trickle(t, "Alice", alice, done)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				video.WriteSample(media.Sample{Data: []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a}, Duration: 20 * time.Millisecond})
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// The relay offers the track to Bob.
+	bob, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	defer bob.Close()
+	received := make(chan *webrtc.TrackRemote, 1)
+	bob.OnTrack(func(remote *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		received <- remote
+	})
+	assert.NoError(t, bob.SetRemoteDescription(readDescription(t, m.box("Bob"), kecpmsg.VideoOffer)))
+	m.trickle(t, "Bob", bob, done)
+	answer, err := bob.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, relay.Write(&kecpmsg.Message{
+		Type:    kecpmsg.VideoAnswer,
+		Name:    "Bob",
+		Target:  kecpmsg.RelayName,
+		Payload: localDescription(t, bob, answer),
+	}))
+	select {
+	case remote := <-received:
+		assert.Equal(t, "alice", remote.StreamID())
+		assert.Equal(t, webrtc.MimeTypeVP8, remote.Codec().MimeType)
+	case <-time.After(10 * time.Second):
+		t.Fatal("no track forwarded to Bob")
+	}
+
+	// The track is withdrawn once Alice leaves.
+	assert.NoError(t, relay.Write(kecpmsg.NewLeaveMsg("Alice", "")))
+	desc := readDescription(t, m.box("Bob"), kecpmsg.VideoOffer)
+	assert.NoError(t, bob.SetRemoteDescription(desc))
+	assert.NotContains(t, desc.SDP, "a=sendonly")
+	assert.NotContains(t, desc.SDP, "a=sendrecv")
+}
+
+func TestRelayClosed(t *testing.T) {
+	relay := New(Config{}, func(message *kecpmsg.Message) {})
+	relay.Close()
+	assert.ErrorIs(t, relay.Write(kecpmsg.NewJoinMsg("Alice", "")), ErrRelayIsClosed)
+}
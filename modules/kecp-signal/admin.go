@@ -0,0 +1,274 @@
+package kecpsignal
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// The window over which the message rate of a room is measured.
+	messageRateWindow = time.Minute
+
+	// Maximum number of registry events waiting for a subscriber.
+	maxPendingEvents = 64
+
+	// Time allowed for a room to give its details.
+	roomDetailsWait = time.Second
+)
+
+// RoomDetails is what the operators see of a room served by this node.
+type RoomDetails struct {
+	RoomInfo
+
+	// The members on this node, then the ones on the others, and the waiting clients.
+	MemberList []MemberDetails
+
+	// The messages from the members per second over the last minute.
+	MessageRate float64
+}
+
+type MemberDetails struct {
+	Name string
+
+	// The fingerprint of the client key, empty for the members on other nodes.
+	Key string
+
+	// The address of the client, empty for the members on other nodes.
+	Addr string
+
+	// When the client joined, zero for the members on other nodes.
+	JoinedAt time.Time
+
+	// Whether the connection was lost and may be resumed.
+	Away bool
+
+	// Whether the client is waiting in the lobby.
+	Waiting bool
+
+	// Whether the client is on another node.
+	Remote bool
+}
+
+type disconnection struct {
+	name string
+	err  chan error
+}
+
+// rateMeter measures the rate of the messages over a window.
+// Only the room's run goroutine can access it.
+type rateMeter struct {
+	start time.Time
+	count int
+	rate  float64
+}
+
+func (m *rateMeter) add(now time.Time) {
+	m.roll(now)
+	m.count++
+}
+
+// roll starts a new window once the current one is over.
+func (m *rateMeter) roll(now time.Time) {
+	elapsed := now.Sub(m.start)
+	if elapsed < messageRateWindow {
+		return
+	}
+	if elapsed < 2*messageRateWindow {
+		m.rate = float64(m.count) / elapsed.Seconds()
+	} else {
+		// No message in the last window.
+		m.rate = 0
+	}
+	m.start = now
+	m.count = 0
+}
+
+func (m *rateMeter) get(now time.Time) float64 {
+	m.roll(now)
+	return m.rate
+}
+
+func memberDetails(client *Client) MemberDetails {
+	return MemberDetails{
+		Name:     client.name,
+		Key:      fingerprint(client.clientKey),
+		Addr:     client.remoteAddr,
+		JoinedAt: client.joinedAt,
+	}
+}
+
+func (room *Room) details() *RoomDetails {
+	details := &RoomDetails{RoomInfo: *room.info(), MessageRate: room.messageRate.get(time.Now())}
+	for _, client := range room.clients {
+		details.MemberList = append(details.MemberList, memberDetails(client))
+	}
+	for _, client := range room.sessions.away {
+		member := memberDetails(client)
+		member.Away = true
+		details.MemberList = append(details.MemberList, member)
+	}
+	for name := range room.remoteMembers {
+		details.MemberList = append(details.MemberList, MemberDetails{Name: name, Remote: true})
+	}
+	for _, client := range room.lobby.waiting {
+		member := memberDetails(client)
+		member.Waiting = true
+		details.MemberList = append(details.MemberList, member)
+	}
+	return details
+}
+
+// disconnect closes the client of this node with the name,
+// and tells the others that it left.
+func disconnect(room *Room, name string) error {
+	if client := findMemberByName(room, name); client != nil {
+		if room.sessions.isAway(client) {
+			dismissAway(room, client)
+		} else {
+			expel(room, client)
+		}
+		return nil
+	}
+	if client := findWaitingClientByName(room, name); client != nil {
+		removeFromLobby(room, client)
+		client.left = true
+		closeClient(client)
+		return nil
+	}
+	return ErrUserNotFound
+}
+
+// Rooms returns the details of the rooms served by this node.
+// The rooms too busy to answer in time are left out.
+func (reg *Registry) Rooms() []*RoomDetails {
+	reply := make(chan []*Room, 1)
+	reg.roomsQuery.Write(reply)
+	var rooms []*Room
+	select {
+	case rooms = <-reply:
+	case <-reg.done:
+		return nil
+	}
+	var details []*RoomDetails
+	for _, room := range rooms {
+		roomReply := make(chan *RoomDetails, 1)
+		room.detailsQuery.Write(roomReply)
+		timer := time.NewTimer(roomDetailsWait)
+		select {
+		case roomDetails := <-roomReply:
+			details = append(details, roomDetails)
+		case <-room.done:
+		case <-timer.C:
+			reg.log().Warn("room details timed out", "room", room.RoomID)
+		}
+		timer.Stop()
+	}
+	return details
+}
+
+// ForceDeleteRoom deletes the room without the management key.
+func (reg *Registry) ForceDeleteRoom(roomID string) error {
+	return reg.deleteRoom(&roomDeletion{roomID: roomID, force: true, err: make(chan error, 1)})
+}
+
+// Disconnect closes the client with the name in the room,
+// whether it is a member or waiting in the lobby.
+// The client may come back unless it is banned.
+func (reg *Registry) Disconnect(roomID string, name string) error {
+	room := reg.GetRoom(roomID)
+	if room == nil {
+		return ErrRoomNotFound
+	}
+	request := &disconnection{name: name, err: make(chan error, 1)}
+	room.disconnection.Write(request)
+	select {
+	case err := <-request.err:
+		return err
+	case <-room.done:
+		return ErrRoomNotFound
+	}
+}
+
+type RegistryEventType string
+
+const (
+	RoomCreated  RegistryEventType = "room-created"
+	RoomDeleted  RegistryEventType = "room-deleted"
+	ClientJoined RegistryEventType = "client-joined"
+	ClientLeft   RegistryEventType = "client-left"
+)
+
+// RegistryEvent tells the operators what happened to the rooms of this node.
+type RegistryEvent struct {
+	Type   RegistryEventType
+	Time   time.Time
+	RoomID string
+
+	// The client joining or leaving, empty for the room events.
+	Name string
+
+	// The fingerprint of the client key, empty for the members on other nodes.
+	Key string
+}
+
+// feed hands the registry events over to the subscribers.
+// The events are dropped for the subscribers which fall behind.
+type feed struct {
+	mu          sync.Mutex
+	subscribers map[chan *RegistryEvent]bool
+	closed      bool
+}
+
+func (f *feed) publish(event *RegistryEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for events := range f.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+func (f *feed) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for events := range f.subscribers {
+		close(events)
+	}
+	f.subscribers = nil
+}
+
+// Events delivers the registry events until cancel is called,
+// or the registry is closed, which closes the channel.
+func (reg *Registry) Events() (events <-chan *RegistryEvent, cancel func()) {
+	f := &reg.events
+	ch := make(chan *RegistryEvent, maxPendingEvents)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if f.subscribers == nil {
+		f.subscribers = make(map[chan *RegistryEvent]bool)
+	}
+	f.subscribers[ch] = true
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.subscribers[ch] {
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func notify(room *Room, eventType RegistryEventType, name string, clientKey string) {
+	event := &RegistryEvent{Type: eventType, Time: time.Now(), RoomID: room.RoomID, Name: name}
+	if clientKey != "" {
+		event.Key = fingerprint(clientKey)
+	}
+	room.registry.events.publish(event)
+}
@@ -0,0 +1,83 @@
+package kecpsignal_test
+
+import (
+	"testing"
+	"time"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/stretchr/testify/assert"
+)
+
+func readEvent(t *testing.T, events <-chan *RegistryEvent) *RegistryEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(3 * time.Second):
+		t.Fatal("no event")
+	}
+	return nil
+}
+
+func TestAdmin(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	events, cancel := reg.Events()
+	defer cancel()
+
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey)
+	assert.Equal(t, &RegistryEvent{Type: RoomCreated, RoomID: roomID}, withoutTime(readEvent(t, events)))
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	assert.Equal(t, kecpmsg.List, readMsg(t, alice).Type)
+	joined := readEvent(t, events)
+	assert.Equal(t, ClientJoined, joined.Type)
+	assert.Equal(t, "Alice", joined.Name)
+	assert.Len(t, joined.Key, 16)
+	bob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: newKey()})
+	assert.Equal(t, kecpmsg.List, readMsg(t, bob).Type)
+	assert.Equal(t, "Bob", readEvent(t, events).Name)
+
+	writeMsg(t, bob, &kecpmsg.Message{Type: kecpmsg.Chat, Name: "Bob", Payload: "hello"})
+	readMsgOfType(t, alice, kecpmsg.Chat)
+	rooms := reg.Rooms()
+	if !assert.Len(t, rooms, 1) {
+		t.FailNow()
+	}
+	assert.Equal(t, roomID, rooms[0].RoomID)
+	assert.Equal(t, 2, rooms[0].Members)
+	assert.Len(t, rooms[0].MemberList, 2)
+	for _, member := range rooms[0].MemberList {
+		assert.Contains(t, member.Addr, "127.0.0.1:")
+		assert.False(t, member.JoinedAt.IsZero())
+	}
+
+	// The operators disconnect the clients without the management key.
+	assert.ErrorIs(t, reg.Disconnect(roomID, "Carol"), ErrUserNotFound)
+	assert.ErrorIs(t, reg.Disconnect("nowhere", "Bob"), ErrRoomNotFound)
+	assert.NoError(t, reg.Disconnect(roomID, "Bob"))
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Leave).Payload)
+	left := readEvent(t, events)
+	assert.Equal(t, ClientLeft, left.Type)
+	assert.Equal(t, "Bob", left.Name)
+
+	assert.NoError(t, reg.ForceDeleteRoom(roomID))
+	assert.Equal(t, &RegistryEvent{Type: RoomDeleted, RoomID: roomID}, withoutTime(readEvent(t, events)))
+	for {
+		if _, _, err := alice.ReadMessage(); err != nil {
+			break
+		}
+	}
+	assert.Empty(t, reg.Rooms())
+
+	// The feed ends with the registry.
+	assert.NoError(t, reg.Close())
+	for range events {
+	}
+}
+
+func withoutTime(event *RegistryEvent) *RegistryEvent {
+	event.Time = time.Time{}
+	return event
+}
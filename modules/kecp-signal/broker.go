@@ -0,0 +1,323 @@
+package kecpsignal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	kecpbroker "github.com/fourdim/kecp/modules/kecp-broker"
+	kecpcrypto "github.com/fourdim/kecp/modules/kecp-crypto"
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	kecpstore "github.com/fourdim/kecp/modules/kecp-store"
+)
+
+const (
+	// The events queued for the other nodes before they are dropped.
+	outboxSize = 1024
+
+	// How often the node which created the room keeps its record.
+	roomKeepPeriod = kecpbroker.RoomTTL / 3
+)
+
+// remoteMember is a member of the room whose client is on another node.
+type remoteMember struct {
+	node    string
+	keyHash []byte
+	joinSeq uint64
+	away    bool
+}
+
+func hashKey(key string) []byte {
+	return kecpcrypto.HashSha256([]byte(key))
+}
+
+// record returns what the other nodes need to serve the room.
+func (room *Room) record() *kecpbroker.RoomRecord {
+	return &kecpbroker.RoomRecord{
+		RoomID:         room.RoomID,
+		MgtKeyHash:     room.mgtKeyHash,
+		PassphraseSalt: room.passphraseSalt,
+		PassphraseHash: room.passphraseHash,
+		CreatedAt:      room.CreatedAt,
+		MaxMembers:     room.maxMembers,
+		Locked:         room.locked,
+		InviteOnly:     room.inviteOnly,
+		Topology:       room.topology,
+		Relay:          room.relayRequested,
+		InviteUses:     inviteUseHashes(room),
+	}
+}
+
+// storeRecord converts the record of the room for the store.
+func storeRecord(record *kecpbroker.RoomRecord) *kecpstore.RoomRecord {
+	stored := kecpstore.RoomRecord(*record)
+	return &stored
+}
+
+// brokerRecord converts the record of the room saved in the store.
+func brokerRecord(stored *kecpstore.RoomRecord) *kecpbroker.RoomRecord {
+	record := kecpbroker.RoomRecord(*stored)
+	return &record
+}
+
+// applySettings takes the settings of the record updated by another node.
+func applySettings(room *Room, record *kecpbroker.RoomRecord) {
+	room.locked = record.Locked
+	room.inviteOnly = record.InviteOnly
+	if room.maxMembers != record.MaxMembers {
+		room.maxMembers = record.MaxMembers
+		admitFromLobby(room)
+	}
+	if room.topology != record.Topology && record.Topology.IsValid() {
+		room.topology = record.Topology
+		replan(room)
+	}
+	saveRoom(room)
+}
+
+// roomFromRecord makes the room out of its record.
+func roomFromRecord(reg *Registry, record *kecpbroker.RoomRecord) *Room {
+	room := newRoom(reg, record.RoomID)
+	room.mgtKeyHash = record.MgtKeyHash
+	room.passphraseSalt = record.PassphraseSalt
+	room.passphraseHash = record.PassphraseHash
+	room.CreatedAt = record.CreatedAt
+	room.maxMembers = record.MaxMembers
+	room.locked = record.Locked
+	room.inviteOnly = record.InviteOnly
+	if record.Topology.IsValid() {
+		room.topology = record.Topology
+	}
+	room.relayRequested = record.Relay
+	for inviteID, keyHashes := range record.InviteUses {
+		room.inviteUses[inviteID] = make(map[string]bool)
+		for _, keyHash := range keyHashes {
+			room.inviteUses[inviteID][string(keyHash)] = true
+		}
+	}
+	return room
+}
+
+// putRecord makes the room known to the other nodes, if there is a broker.
+func putRecord(reg *Registry, record *kecpbroker.RoomRecord) {
+	if reg.broker == nil {
+		return
+	}
+	if err := reg.broker.PutRoom(record); err != nil {
+		reg.log().Error("cannot put the room to the broker", "room", record.RoomID, "error", err)
+	}
+}
+
+// deleteRecord makes the other nodes forget the room, if there is a broker.
+func deleteRecord(reg *Registry, roomID string) {
+	if reg.broker == nil {
+		return
+	}
+	if err := reg.broker.DeleteRoom(roomID); err != nil {
+		reg.log().Error("cannot delete the room from the broker", "room", roomID, "error", err)
+	}
+}
+
+// replicate serves the room created on another node, if the broker knows it.
+func (reg *Registry) replicate(roomID string) *Room {
+	if reg.broker == nil {
+		return nil
+	}
+	record, err := reg.broker.LookupRoom(roomID)
+	if err != nil {
+		if !errors.Is(err, kecpbroker.ErrRoomNotFound) {
+			reg.log().Error("cannot look the room up", "room", roomID, "error", err)
+		}
+		return nil
+	}
+	room := roomFromRecord(reg, record)
+	// Only the node which created the room has its relay.
+	room.replica = true
+	if !room.start() {
+		// Another client got the room replicated first.
+		return reg.getLocalRoom(roomID)
+	}
+	return room
+}
+
+// receive hands the events of the other nodes over to the run goroutine.
+func (room *Room) receive(event *kecpbroker.Event) {
+	if event.Node == room.registry.node {
+		return
+	}
+	select {
+	case room.remote <- event:
+	case <-room.done:
+	}
+}
+
+// publish queues the event for the other nodes, if there is a broker.
+// Only the run goroutine can call it.
+func publish(room *Room, event *kecpbroker.Event) {
+	if room.outbox == nil {
+		return
+	}
+	event.Node = room.registry.node
+	select {
+	case room.outbox <- event:
+	default:
+		brokerEventDrops.Inc()
+		room.registry.log().Warn("event for the other nodes dropped", "room", room.RoomID, "event", event.Type)
+	}
+}
+
+// publishOutbox publishes the events of the outbox in order,
+// until the run goroutine closes it. Meanwhile, the node which created
+// the room keeps its record, which expires once the node is gone.
+func (room *Room) publishOutbox() {
+	reg := room.registry
+	defer reg.outboxes.Done()
+	keeper := time.NewTicker(roomKeepPeriod)
+	defer keeper.Stop()
+	for {
+		select {
+		case event, ok := <-room.outbox:
+			if !ok {
+				return
+			}
+			if err := reg.broker.Publish(room.RoomID, event); err != nil {
+				reg.log().Error("cannot publish the event", "room", room.RoomID, "event", event.Type, "error", err)
+			}
+		case <-keeper.C:
+			if room.replica {
+				break
+			}
+			if err := reg.broker.KeepRoom(room.RoomID); err != nil {
+				reg.log().Error("cannot keep the room in the broker", "room", room.RoomID, "error", err)
+			}
+		}
+	}
+}
+
+// publishMessage tells the other nodes about the message broadcast to the room.
+func publishMessage(room *Room, message *kecpmsg.Message) {
+	// The payload of a join or leave message is the name.
+	name, _ := message.Payload.(string)
+	switch message.Type {
+	case kecpmsg.Join:
+		if client := findMemberByName(room, name); client != nil {
+			publishJoin(room, client)
+		}
+	case kecpmsg.Leave:
+		publish(room, &kecpbroker.Event{Type: kecpbroker.Leave, Name: name})
+	default:
+		publish(room, &kecpbroker.Event{Type: kecpbroker.Broadcast, Message: message})
+	}
+}
+
+func publishJoin(room *Room, client *Client) {
+	publish(room, &kecpbroker.Event{
+		Type:    kecpbroker.Join,
+		Name:    client.name,
+		JoinSeq: client.joinSeq,
+		KeyHash: hashKey(client.clientKey),
+		Away:    room.sessions.isAway(client),
+	})
+}
+
+// handleEvent applies the event of another node to the room.
+// It reports whether the room was deleted.
+func handleEvent(room *Room, event *kecpbroker.Event) bool {
+	switch event.Type {
+	case kecpbroker.Broadcast:
+		if event.Message == nil {
+			break
+		}
+		if event.Message.Type == kecpmsg.Playback {
+			var state kecpmsg.PlaybackState
+			if b, err := json.Marshal(event.Message.Payload); err == nil && json.Unmarshal(b, &state) == nil {
+				room.playback.sync(state)
+			}
+		}
+		broadcastLocally(room, event.Message)
+		if event.Message.Type == kecpmsg.Playback {
+			followStreamer(room, event.Message.Name)
+		}
+	case kecpbroker.Forward:
+		if event.Message == nil {
+			break
+		}
+		if event.Message.Target == kecpmsg.RelayName {
+			writeToRelay(room, event.Message)
+			break
+		}
+		forwardLocally(room, event.Message)
+	case kecpbroker.Join:
+		if client := findMemberByName(room, event.Name); client != nil {
+			if !bytes.Equal(hashKey(client.clientKey), event.KeyHash) {
+				// Both nodes let a client in with the name at once.
+				break
+			}
+			// The client came back on the other node.
+			room.registry.log().Info("client moved to another node", clientAttrs(client)...)
+			delete(room.clients, client.clientKey)
+			delete(room.sessions.away, client.clientKey)
+			client.left = true
+			closeClient(client)
+			broadcastLocally(room, kecpmsg.NewLeaveMsg(client.name, client.clientKey))
+		}
+		previous, known := room.remoteMembers[event.Name]
+		room.remoteMembers[event.Name] = &remoteMember{node: event.Node, keyHash: event.KeyHash, joinSeq: event.JoinSeq, away: event.Away}
+		switch {
+		case !known:
+			broadcastLocally(room, kecpmsg.NewJoinMsg(event.Name, ""))
+		case previous.node != event.Node:
+			broadcastLocally(room, kecpmsg.NewLeaveMsg(event.Name, ""))
+			broadcastLocally(room, kecpmsg.NewJoinMsg(event.Name, ""))
+		}
+		replan(room)
+	case kecpbroker.Leave:
+		if member, ok := room.remoteMembers[event.Name]; ok && member.node == event.Node {
+			delete(room.remoteMembers, event.Name)
+			broadcastLocally(room, kecpmsg.NewLeaveMsg(event.Name, ""))
+			replan(room)
+			admitFromLobby(room)
+		}
+	case kecpbroker.Sync:
+		for _, client := range room.members() {
+			publishJoin(room, client)
+		}
+		if state := moderationState(room); state != nil {
+			publish(room, &kecpbroker.Event{Type: kecpbroker.Moderation, Moderation: state})
+		}
+	case kecpbroker.Update:
+		if event.Record != nil {
+			applySettings(room, event.Record)
+		}
+	case kecpbroker.Moderation:
+		if event.Moderation == nil {
+			break
+		}
+		applyModeration(room, event.Moderation)
+		expelBanned(room)
+		admitFromLobby(room)
+	case kecpbroker.Expel:
+		if target := findClientByName(room, event.Name); target != nil {
+			expel(room, target)
+			admitFromLobby(room)
+		}
+	case kecpbroker.Delete:
+		for _, client := range append(room.members(), room.lobby.waiting...) {
+			closeClient(client)
+		}
+		return true
+	}
+	return false
+}
+
+// isRemoteMember reports whether the client key belongs to a member on another node.
+func isRemoteMember(room *Room, clientKey string) bool {
+	keyHash := hashKey(clientKey)
+	for _, member := range room.remoteMembers {
+		if bytes.Equal(member.keyHash, keyHash) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package kecpsignal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	kecpbroker "github.com/fourdim/kecp/modules/kecp-broker"
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// readPlanWithPeers skips the plans until one with the given peer count arrives.
+func readPlanWithPeers(t *testing.T, conn *websocket.Conn, peers int) kecpmsg.PeerPlan {
+	for {
+		plan := readPlan(t, conn)
+		if len(plan.Peers) == peers {
+			return plan
+		}
+	}
+}
+
+func testNodes(t *testing.T, brokerA kecpbroker.Broker, brokerB kecpbroker.Broker) {
+	nodeA := NewRegistry(WithBroker(brokerA))
+	nodeB := NewRegistry(WithBroker(brokerB))
+	urlA := newTestServer(t, nodeA)
+	urlB := newTestServer(t, nodeB)
+	mgtKey := newKey()
+	roomID := nodeA.NewRoom(mgtKey)
+
+	alice := dial(t, urlA, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	assert.Equal(t, kecpmsg.List, readMsg(t, alice).Type)
+
+	// Bob joins the room on the other node.
+	bobKey := newKey()
+	bob := dial(t, urlB, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: bobKey})
+	assert.Equal(t, kecpmsg.List, readMsg(t, bob).Type)
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Join).Payload)
+	assert.Equal(t, []kecpmsg.PeerLink{
+		{Name: "Bob", Offer: true, Send: true, Receive: true},
+	}, readPlanWithPeers(t, alice, 1).Peers)
+	assert.Equal(t, []kecpmsg.PeerLink{
+		{Name: "Alice", Polite: true, Send: true, Receive: true},
+	}, readPlanWithPeers(t, bob, 1).Peers)
+	assert.True(t, nodeA.IsMember(roomID, bobKey))
+
+	// The names are unique across the nodes.
+	carol := dial(t, urlA, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: newKey()})
+	assert.Equal(t, ErrNameIsAlreadyInUse.Error(), readMsg(t, carol).Payload)
+
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.VideoOffer, Name: "Alice", Target: "Bob", Payload: "offer"})
+	offer := readMsgOfType(t, bob, kecpmsg.VideoOffer)
+	assert.Equal(t, "Alice", offer.Name)
+	assert.Equal(t, "offer", offer.Payload)
+
+	writeMsg(t, bob, &kecpmsg.Message{Type: kecpmsg.Chat, Name: "Bob", Payload: "hello"})
+	chat := readMsgOfType(t, alice, kecpmsg.Chat)
+	assert.Equal(t, "Bob", chat.Name)
+	assert.Equal(t, "hello", chat.Payload)
+
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Play, Name: "Alice", Payload: 42.0})
+	state := readMsgOfType(t, bob, kecpmsg.Playback)
+	assert.Equal(t, false, state.Payload.(map[string]interface{})["paused"])
+
+	// The settings are shared.
+	locked := true
+	info, err := nodeB.UpdateRoomSettings(roomID, mgtKey, RoomSettings{Locked: &locked})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, info.Members)
+	dave := dial(t, urlA, kecpmsg.AuthMessage{RoomID: roomID, Name: "Dave", ClientKey: newKey()})
+	assert.Equal(t, ErrRoomIsLocked.Error(), readMsg(t, dave).Payload)
+
+	bob.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Leave).Payload)
+
+	// The creator deletes the room on every node.
+	erin := dial(t, urlB, kecpmsg.AuthMessage{RoomID: roomID, Name: "Erin", ClientKey: mgtKey})
+	assert.Equal(t, kecpmsg.List, readMsg(t, erin).Type)
+	assert.NoError(t, nodeA.DeleteRoom(roomID, mgtKey))
+	for _, conn := range []*websocket.Conn{alice, erin} {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				break
+			}
+		}
+	}
+}
+
+func TestMemoryBroker(t *testing.T) {
+	broker := kecpbroker.NewMemory()
+	defer broker.Close()
+	testNodes(t, broker, broker)
+}
+
+func TestRedisBroker(t *testing.T) {
+	server := miniredis.RunT(t)
+	brokerA, err := kecpbroker.NewRedis("redis://" + server.Addr())
+	assert.NoError(t, err)
+	defer brokerA.Close()
+	brokerB, err := kecpbroker.NewRedis("redis://" + server.Addr())
+	assert.NoError(t, err)
+	defer brokerB.Close()
+	testNodes(t, brokerA, brokerB)
+}
+
+func TestModerationAcrossNodes(t *testing.T) {
+	broker := kecpbroker.NewMemory()
+	defer broker.Close()
+	nodeA := NewRegistry(WithBroker(broker), WithInviteSecret([]byte("secret")))
+	nodeB := NewRegistry(WithBroker(broker), WithInviteSecret([]byte("secret")))
+	urlA := newTestServer(t, nodeA)
+	urlB := newTestServer(t, nodeB)
+	mgtKey := newKey()
+	roomID := nodeA.NewRoom(mgtKey)
+
+	alice := dial(t, urlA, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	readMsgOfType(t, alice, kecpmsg.List)
+	bobKey := newKey()
+	bob := dial(t, urlB, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: bobKey})
+	readMsgOfType(t, bob, kecpmsg.List)
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Join).Payload)
+
+	// The mutes hold on the node of the member.
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Mute, Name: "Alice", Payload: "Bob"})
+	assert.Equal(t, "Bob", readNotice(t, bob, kecpmsg.Mute)["target"])
+	writeMsg(t, bob, &kecpmsg.Message{Type: kecpmsg.Chat, Name: "Bob", Payload: "spam"})
+	assert.Equal(t, ErrMutedInTheRoom.Error(), readMsgOfType(t, bob, kecpmsg.Error).Payload)
+
+	// The node of the member expels it.
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Kick, Name: "Alice", Payload: "Bob"})
+	assert.Equal(t, "Bob", readNotice(t, bob, kecpmsg.Kick)["target"])
+	for {
+		if _, _, err := bob.ReadMessage(); err != nil {
+			break
+		}
+	}
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Leave).Payload)
+
+	bob = dial(t, urlB, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: bobKey})
+	readMsgOfType(t, bob, kecpmsg.List)
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Join).Payload)
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Ban, Name: "Alice", Payload: kecpmsg.BanTarget{Name: "Bob"}})
+	assert.Equal(t, "Bob", readNotice(t, bob, kecpmsg.Ban)["target"])
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Leave).Payload)
+
+	// The bans hold on every node, for both the name and the key.
+	for _, auth := range []kecpmsg.AuthMessage{
+		{RoomID: roomID, Name: "Bob", ClientKey: newKey()},
+		{RoomID: roomID, Name: "Eve", ClientKey: bobKey},
+	} {
+		for _, url := range []string{urlA, urlB} {
+			conn := dial(t, url, auth)
+			assert.Equal(t, ErrBannedFromTheRoom.Error(), readMsgOfType(t, conn, kecpmsg.Error).Payload)
+		}
+	}
+
+	// The uses of an invite are counted on every node.
+	invite, err := nodeA.NewInvite(roomID, mgtKey, time.Minute, 1)
+	assert.NoError(t, err)
+	carol := dial(t, urlB, kecpmsg.AuthMessage{RoomID: roomID, Name: "Carol", ClientKey: newKey(), Invite: invite.Token})
+	readMsgOfType(t, carol, kecpmsg.List)
+	assert.Equal(t, "Carol", readMsgOfType(t, alice, kecpmsg.Join).Payload)
+	dave := dial(t, urlA, kecpmsg.AuthMessage{Name: "Dave", ClientKey: newKey(), Invite: invite.Token})
+	assert.Equal(t, ErrInviteExhausted.Error(), readMsg(t, dave).Payload)
+}
+
+func TestRoomNotOnAnyNode(t *testing.T) {
+	reg := NewRegistry()
+	assert.Nil(t, reg.GetRoom("nowhere"))
+	assert.ErrorIs(t, reg.DeleteRoom("nowhere", newKey()), ErrRoomNotFound)
+}
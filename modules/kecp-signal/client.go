@@ -30,6 +30,18 @@ const (
 
 	// Time allowed to get an ack from a room.
 	clientJoinedCheckWait = 2 * time.Second
+
+	// Maximum number of clock-pong messages waiting to be written.
+	maxPendingClockPongs = 8
+
+	// Incorrect passphrases allowed before the next attempts are delayed.
+	passphraseAttemptsBeforeDelay = 3
+
+	// The delay added for each incorrect passphrase beyond the allowed ones.
+	passphraseRetryDelay = 2 * time.Second
+
+	// Incorrect passphrases allowed before the connection is closed.
+	maxPassphraseAttempts = 6
 )
 
 var (
@@ -54,14 +66,71 @@ type Client struct {
 	// The websocket connection.
 	conn WebscoketConn
 
+	// The address of the peer, for the logs.
+	// Should be readonly.
+	remoteAddr string
+
 	// Buffered channel of outbound messages.
 	send chan *kecpmsg.Message
 
-	// The status returned after register.
-	joined chan bool
+	// Buffered channel of clock-pong messages.
+	// Written by the readPump and never closed.
+	clockPong chan *kecpmsg.Message
+
+	// The status returned after register, nil if joined.
+	joined chan error
 
 	// Channel for self destruction.
+	// The writePump returns at once, dropping the queued messages.
 	selfDestruction chan bool
+
+	// The invite presented on auth, nil if there is none.
+	// Should be readonly.
+	invite *inviteClaims
+
+	// The resume token presented on auth.
+	// Replaced by the room with a fresh one once joined.
+	resumeToken string
+
+	// Whether the connection was lost rather than closed by the client.
+	// Written by the readPump before unregistering.
+	lost bool
+
+	// The messages the client may send before it is rate limited.
+	// Only the readPump goroutine can access it.
+	bucket messageBucket
+
+	// Closed by the readPump when the connection is gone.
+	disconnected chan struct{}
+
+	// The order in which the client joined the room.
+	// Only the room's run goroutine can access it.
+	joinSeq uint64
+
+	// When the client joined the room.
+	// Only the room's run goroutine can access it.
+	joinedAt time.Time
+
+	// The plan last sent to the client.
+	// Only the room's run goroutine can access it.
+	plan *kecpmsg.PeerPlan
+
+	// Whether the send channel is closed.
+	// Only the room's run goroutine can access it.
+	closed bool
+
+	// Whether the others have been told that the client left.
+	// Only the room's run goroutine can access it.
+	left bool
+
+	// Whether messages for the client were dropped while it was away.
+	// Only the room's run goroutine can access it.
+	overflowed bool
+
+	// The close code sent once the room closed the send channel,
+	// 0 for a close message without one.
+	// Written by the room's run goroutine before closing the send channel.
+	closeCode int
 }
 
 type WebscoketConn interface {
@@ -76,7 +145,20 @@ type WebscoketConn interface {
 }
 
 func (reg *Registry) NewClient(conn WebscoketConn) (retErr error) {
+	var auth *kecpmsg.AuthMessage
 	defer func() {
+		if retErr != nil {
+			authFailures.WithLabelValues(retErr.Error()).Inc()
+			args := []any{"addr", remoteAddr(conn), "error", retErr}
+			if auth != nil {
+				args = append(args, "room", auth.RoomID, "name", auth.Name, "key", fingerprint(auth.ClientKey))
+			}
+			if errors.Is(retErr, ErrConnectionLost) {
+				reg.log().Debug("auth failed", args...)
+			} else {
+				reg.log().Warn("auth failed", args...)
+			}
+		}
 		if retErr != nil && !errors.Is(retErr, ErrConnectionLost) {
 			sendErrorMsg(conn, retErr)
 		}
@@ -85,60 +167,115 @@ func (reg *Registry) NewClient(conn WebscoketConn) (retErr error) {
 		}
 	}()
 	conn.SetReadLimit(maxMessageSize)
-	conn.SetReadDeadline(time.Now().Add(authWait))
-	_, msg, err := conn.ReadMessage()
-	if err != nil {
-		return ErrConnectionLost
-	}
-	var auth kecpmsg.AuthMessage
-	conn.SetWriteDeadline(time.Now().Add(writeWait))
-	if err := json.Unmarshal(msg, &auth); err != nil {
-		return ErrCanNotJoinTheRoom
-	}
-	if !kecpvalidate.IsAValidCryptoKey(auth.ClientKey) {
-		return ErrNotAValidKey
+	if reg.IsDraining() {
+		return ErrServerIsShuttingDown
 	}
-	if !kecpvalidate.IsAValidUserName(auth.Name) {
-		return ErrNotAValidName
-	}
-	room := reg.GetRoom(auth.RoomID)
-	if room == nil {
-		return ErrCanNotJoinTheRoom
+	var invite *inviteClaims
+	var room *Room
+	var delay time.Duration
+	for failures := 0; ; {
+		var err error
+		auth, err = reg.readAuthMsgAfter(conn, delay)
+		if err != nil {
+			return err
+		}
+		if auth.Invite != "" {
+			invite, err = reg.verifyInvite(auth.Invite)
+			if err != nil {
+				return err
+			}
+			if auth.RoomID == "" {
+				auth.RoomID = invite.RoomID
+			} else if auth.RoomID != invite.RoomID {
+				return ErrNotAValidInvite
+			}
+		}
+		room = reg.GetRoom(auth.RoomID)
+		if room == nil {
+			return ErrCanNotJoinTheRoom
+		}
+		verified, err := reg.verifyPassphrase(room, auth.Passphrase, remoteAddr(conn))
+		if err != nil {
+			return err
+		}
+		if verified {
+			break
+		}
+		failures++
+		if delay, err = passphraseRetry(conn, failures); err != nil {
+			return err
+		}
 	}
 	client := &Client{
 		clientKey:       auth.ClientKey,
 		name:            auth.Name,
 		room:            room,
 		conn:            conn,
+		remoteAddr:      remoteAddr(conn),
 		send:            make(chan *kecpmsg.Message, 256),
-		joined:          make(chan bool),
-		selfDestruction: make(chan bool),
+		clockPong:       make(chan *kecpmsg.Message, maxPendingClockPongs),
+		joined:          make(chan error, 1),
+		selfDestruction: make(chan bool, 1),
+		invite:          invite,
+		resumeToken:     auth.ResumeToken,
+		disconnected:    make(chan struct{}),
 	}
 	room.register.Write(client)
 	checker := time.NewTimer(clientJoinedCheckWait)
 	defer checker.Stop()
 	select {
-	case joined := <-client.joined:
-		if !joined {
-			return ErrNameIsAlreadyInUse
+	case err := <-client.joined:
+		if err != nil {
+			return err
 		}
 	case <-checker.C:
 		sendErrorMsg(conn, ErrCanNotJoinTheRoom)
 		return ErrCanNotJoinTheRoom
 	}
-	client.sendListMsg()
+	if !reg.trackPumps() {
+		return ErrServerIsShuttingDown
+	}
+	clientsGauge.Inc()
+	client.sendFirstMsg()
 	go client.readPump()
 	go client.writePump()
 	return nil
 }
 
+func readAuthMsg(conn WebscoketConn, wait time.Duration) (*kecpmsg.AuthMessage, error) {
+	conn.SetReadDeadline(time.Now().Add(wait))
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		return nil, ErrConnectionLost
+	}
+	var auth kecpmsg.AuthMessage
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := json.Unmarshal(msg, &auth); err != nil {
+		return nil, ErrCanNotJoinTheRoom
+	}
+	if !kecpvalidate.IsAValidCryptoKey(auth.ClientKey) {
+		return nil, ErrNotAValidKey
+	}
+	if !kecpvalidate.IsAValidUserName(auth.Name) {
+		return nil, ErrNotAValidName
+	}
+	return &auth, nil
+}
+
+func writeErrorMsg(conn WebscoketConn, err error) {
+	conn.WriteMessage(ws.TextMessage, kecpmsg.NewErrorMsg(err).BuildAt(time.Now()))
+}
+
 func sendErrorMsg(conn WebscoketConn, err error) {
-	conn.WriteMessage(ws.TextMessage, kecpmsg.NewErrorMsg(err).Build())
+	writeErrorMsg(conn, err)
 	conn.WriteMessage(ws.CloseMessage, []byte{})
 }
 
-func (c *Client) sendListMsg() {
-	c.conn.WriteMessage(ws.TextMessage, (<-c.send).Build())
+// sendFirstMsg writes the message queued by the room on register,
+// which is the list message, the lobby message when the room is full,
+// or the session message on resumption.
+func (c *Client) sendFirstMsg() {
+	c.conn.WriteMessage(ws.TextMessage, (<-c.send).BuildAt(time.Now()))
 }
 
 // readPump pumps messages from the websocket connection to the room.
@@ -150,26 +287,48 @@ func (c *Client) sendListMsg() {
 // server <- client
 func (c *Client) readPump() {
 	defer func() {
+		close(c.disconnected)
 		c.room.unregister.Write(c)
 		c.conn.Close()
+		clientsGauge.Dec()
+		c.room.registry.pumps.Done()
 	}()
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 	for {
 		_, msg, err := c.conn.ReadMessage()
+		receivedAt := time.Now()
 		if err != nil {
 			if ws.IsUnexpectedCloseError(err, ws.CloseGoingAway, ws.CloseAbnormalClosure) {
-				logger.Printf("error: %v", err)
+				c.room.registry.log().Warn("unexpected close", clientAttrs(c, "error", err)...)
 			}
+			// The client may come back with the resume token.
+			c.lost = !ws.IsCloseError(err, ws.CloseNormalClosure, ws.CloseGoingAway)
 			break
 		}
+		if !c.bucket.take(c.room.registry.Limits().MessagesPerSecond, receivedAt) {
+			rateLimitedMessages.Inc()
+			c.room.registry.log().Debug("message rate limited", clientAttrs(c)...)
+			continue
+		}
 		msg = bytes.TrimSpace(bytes.Replace(msg, newline, space, -1))
 		kecpMsg, err := kecpmsg.Parse(msg, c.name)
 		if err != nil {
 			continue
 		}
+		messages.WithLabelValues(string(kecpMsg.Type)).Inc()
 
-		if kecpMsg.NeedBroadcast() {
+		if kecpMsg.IsModeration() {
+			c.room.moderation.Write(&moderation{moderator: c, message: kecpMsg})
+		} else if kecpMsg.Type == kecpmsg.ClockPing {
+			// Answered by the writePump, which stamps the transmit time.
+			select {
+			case c.clockPong <- kecpmsg.NewClockPongMsg(kecpMsg.Payload.(float64), receivedAt.UnixMilli()):
+			default:
+			}
+		} else if kecpMsg.IsPlaybackControl() {
+			c.room.playbackControl.Write(kecpMsg)
+		} else if kecpMsg.NeedBroadcast() {
 			c.room.broadcast.Write(kecpMsg)
 		} else {
 			c.room.forward.Write(kecpMsg)
@@ -189,6 +348,7 @@ func (c *Client) writePump() {
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
+		c.room.registry.pumps.Done()
 	}()
 	for {
 		select {
@@ -196,10 +356,14 @@ func (c *Client) writePump() {
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// The room closed the channel.
-				c.conn.WriteMessage(ws.CloseMessage, []byte{})
+				if c.closeCode != 0 {
+					c.conn.WriteMessage(ws.CloseMessage, ws.FormatCloseMessage(c.closeCode, ""))
+				} else {
+					c.conn.WriteMessage(ws.CloseMessage, []byte{})
+				}
 				return
 			}
-			err := c.conn.WriteMessage(ws.TextMessage, kecpMsg.Build())
+			err := c.conn.WriteMessage(ws.TextMessage, kecpMsg.BuildAt(time.Now()))
 			if err != nil {
 				return
 			}
@@ -207,16 +371,24 @@ func (c *Client) writePump() {
 			n := len(c.send)
 			for i := 0; i < n; i++ {
 				kecpMsg := <-c.send
-				err := c.conn.WriteMessage(ws.TextMessage, kecpMsg.Build())
+				err := c.conn.WriteMessage(ws.TextMessage, kecpMsg.BuildAt(time.Now()))
 				if err != nil {
 					return
 				}
 			}
+		case kecpMsg := <-c.clockPong:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(ws.TextMessage, kecpMsg.BuildAt(time.Now())); err != nil {
+				return
+			}
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.conn.WriteMessage(ws.PingMessage, nil); err != nil {
 				return
 			}
+		case <-c.disconnected:
+			// Leave the queued messages for a resumption.
+			return
 		case <-c.selfDestruction:
 			return
 		}
@@ -0,0 +1,33 @@
+package kecpsignal_test
+
+import (
+	"testing"
+	"time"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockSync(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	roomID := reg.NewRoom(newKey())
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: newKey()})
+	list := readMsg(t, alice)
+	assert.Equal(t, kecpmsg.List, list.Type)
+	assert.NotZero(t, list.ServerTime)
+
+	before := time.Now().UnixMilli()
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.ClockPing, Name: "Alice", Payload: 12345.5})
+	pong := readMsgOfType(t, alice, kecpmsg.ClockPong)
+	after := time.Now().UnixMilli()
+
+	sample := pong.Payload.(map[string]interface{})
+	assert.Equal(t, 12345.5, sample["client_time"])
+	receiveTime := int64(sample["receive_time"].(float64))
+	assert.GreaterOrEqual(t, receiveTime, before)
+	assert.GreaterOrEqual(t, pong.ServerTime, receiveTime)
+	assert.LessOrEqual(t, pong.ServerTime, after)
+}
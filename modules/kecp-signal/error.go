@@ -3,10 +3,30 @@ package kecpsignal
 import "errors"
 
 var (
-	ErrConnectionLost      = errors.New("connection lost")
-	ErrCanNotCreateTheRoom = errors.New("cannot create the room")
-	ErrCanNotJoinTheRoom   = errors.New("cannot join the room")
-	ErrNameIsAlreadyInUse  = errors.New("name is already in use")
-	ErrNotAValidName       = errors.New("not a valid name")
-	ErrNotAValidKey        = errors.New("not a valid key")
+	ErrConnectionLost            = errors.New("connection lost")
+	ErrCanNotCreateTheRoom       = errors.New("cannot create the room")
+	ErrCanNotJoinTheRoom         = errors.New("cannot join the room")
+	ErrNameIsAlreadyInUse        = errors.New("name is already in use")
+	ErrNotAValidName             = errors.New("not a valid name")
+	ErrNotAValidKey              = errors.New("not a valid key")
+	ErrBannedFromTheRoom         = errors.New("banned from the room")
+	ErrMutedInTheRoom            = errors.New("muted in the room")
+	ErrNotTheModerator           = errors.New("not the moderator")
+	ErrUserNotFound              = errors.New("user not found")
+	ErrRoomNotFound              = errors.New("room not found")
+	ErrRoomIsLocked              = errors.New("room is locked")
+	ErrWrongManagementKey        = errors.New("wrong management key")
+	ErrRejectedByTheModerator    = errors.New("rejected by the moderator")
+	ErrNotAValidMaxMembers       = errors.New("not a valid maximum member count")
+	ErrNotAValidPassphrase       = errors.New("not a valid passphrase")
+	ErrIncorrectPassphrase       = errors.New("incorrect passphrase")
+	ErrTooManyPassphraseAttempts = errors.New("too many passphrase attempts")
+	ErrNotAValidInvite           = errors.New("not a valid invite")
+	ErrInviteExpired             = errors.New("invite expired")
+	ErrInviteExhausted           = errors.New("invite exhausted")
+	ErrInviteRequired            = errors.New("invite required")
+	ErrNotAValidTopology         = errors.New("not a valid topology")
+	ErrServerIsShuttingDown      = errors.New("server is shutting down")
+	ErrServerIsBusy              = errors.New("server is busy")
+	ErrTooManyRooms              = errors.New("too many rooms")
 )
@@ -0,0 +1,72 @@
+package kecpsignal_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func newKey() string {
+	b := make([]byte, 48)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// newTestServer starts a websocket server which hands every connection to the registry.
+func newTestServer(t *testing.T, reg *Registry) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		reg.NewClient(conn)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string, auth kecpmsg.AuthMessage) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if !assert.NoError(t, err, "error on dialing") {
+		t.FailNow()
+	}
+	t.Cleanup(func() { conn.Close() })
+	b, _ := json.Marshal(auth)
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, b))
+	return conn
+}
+
+func readMsg(t *testing.T, conn *websocket.Conn) *kecpmsg.Message {
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, b, err := conn.ReadMessage()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	var msg kecpmsg.Message
+	assert.NoError(t, json.Unmarshal(b, &msg))
+	return &msg
+}
+
+// readMsgOfType skips the messages until one of the given type arrives.
+func readMsgOfType(t *testing.T, conn *websocket.Conn, msgType kecpmsg.MsgType) *kecpmsg.Message {
+	for {
+		msg := readMsg(t, conn)
+		if msg.Type == msgType {
+			return msg
+		}
+	}
+}
+
+func writeMsg(t *testing.T, conn *websocket.Conn, msg *kecpmsg.Message) {
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, msg.Build()))
+}
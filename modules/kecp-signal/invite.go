@@ -0,0 +1,103 @@
+package kecpsignal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	kecpbroker "github.com/fourdim/kecp/modules/kecp-broker"
+	kecpcrypto "github.com/fourdim/kecp/modules/kecp-crypto"
+)
+
+// Invite is a signed token letting clients join a room until it expires
+// or its uses are exhausted.
+type Invite struct {
+	Token     string
+	ExpiresAt time.Time
+
+	// The number of distinct clients allowed to join with the token, 0 for unlimited.
+	MaxUses int
+}
+
+// inviteClaims is the signed part of an invite token.
+type inviteClaims struct {
+	RoomID    string `json:"room_id"`
+	InviteID  string `json:"invite_id"`
+	ExpiresAt int64  `json:"expires_at"`
+	MaxUses   int    `json:"max_uses,omitempty"`
+}
+
+// NewInvite issues an invite token for the room, signed with the registry's secret.
+func (reg *Registry) NewInvite(roomID string, managementKey string, ttl time.Duration, maxUses int) (*Invite, error) {
+	if ttl <= 0 || maxUses < 0 {
+		return nil, ErrNotAValidInvite
+	}
+	if _, err := reg.getManagedRoom(roomID, managementKey); err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	claims, _ := json.Marshal(&inviteClaims{
+		RoomID:    roomID,
+		InviteID:  kecpcrypto.GenerateRoomID(),
+		ExpiresAt: expiresAt.Unix(),
+		MaxUses:   maxUses,
+	})
+	signature := kecpcrypto.SignHmacSha256(reg.inviteSecret, claims)
+	token := base64.RawURLEncoding.EncodeToString(claims) + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return &Invite{Token: token, ExpiresAt: expiresAt, MaxUses: maxUses}, nil
+}
+
+// verifyInvite checks the signature and the expiry of the invite token.
+func (reg *Registry) verifyInvite(token string) (*inviteClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrNotAValidInvite
+	}
+	claims, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrNotAValidInvite
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrNotAValidInvite
+	}
+	if !kecpcrypto.VerifyHmacSha256(reg.inviteSecret, claims, signature) {
+		return nil, ErrNotAValidInvite
+	}
+	var invite inviteClaims
+	if err := json.Unmarshal(claims, &invite); err != nil {
+		return nil, ErrNotAValidInvite
+	}
+	if time.Now().Unix() >= invite.ExpiresAt {
+		return nil, ErrInviteExpired
+	}
+	return &invite, nil
+}
+
+// checkInvite tells whether the invite of the client has a use left for it.
+// A client coming back with the same key uses no more of it.
+func checkInvite(room *Room, client *Client) error {
+	if client.invite == nil || client.invite.MaxUses <= 0 {
+		return nil
+	}
+	users := room.inviteUses[client.invite.InviteID]
+	if !users[string(hashKey(client.clientKey))] && len(users) >= client.invite.MaxUses {
+		return ErrInviteExhausted
+	}
+	return nil
+}
+
+// useInvite counts the client, which joined, as a use of its invite on every node.
+func useInvite(room *Room, client *Client) {
+	if client.invite == nil {
+		return
+	}
+	keyHash := hashKey(client.clientKey)
+	if room.inviteUses[client.invite.InviteID][string(keyHash)] {
+		return
+	}
+	shareModeration(room, &kecpbroker.ModerationState{
+		InviteUses: map[string][][]byte{client.invite.InviteID: {keyHash}},
+	})
+}
@@ -0,0 +1,102 @@
+package kecpsignal_test
+
+import (
+	"testing"
+	"time"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvite(t *testing.T) {
+	reg := NewRegistry(WithInviteSecret([]byte("secret")))
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey, WithInviteOnly(true))
+
+	_, err := reg.NewInvite(roomID, newKey(), time.Minute, 1)
+	assert.ErrorIs(t, err, ErrWrongManagementKey)
+	invite, err := reg.NewInvite(roomID, mgtKey, time.Minute, 1)
+	assert.NoError(t, err)
+
+	bob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: newKey()})
+	assert.Equal(t, ErrInviteRequired.Error(), readMsg(t, bob).Payload)
+
+	// The room ID is taken from the invite.
+	aliceKey := newKey()
+	alice := dial(t, url, kecpmsg.AuthMessage{Name: "Alice", ClientKey: aliceKey, Invite: invite.Token})
+	assert.Equal(t, kecpmsg.List, readMsg(t, alice).Type)
+
+	carol := dial(t, url, kecpmsg.AuthMessage{Name: "Carol", ClientKey: newKey(), Invite: invite.Token})
+	assert.Equal(t, ErrInviteExhausted.Error(), readMsg(t, carol).Payload)
+
+	// The same client coming back does not use the invite again.
+	alice.Close()
+	alice = dial(t, url, kecpmsg.AuthMessage{Name: "Alice", ClientKey: aliceKey, Invite: invite.Token})
+	assert.Equal(t, kecpmsg.List, readMsg(t, alice).Type)
+
+	other := dial(t, url, kecpmsg.AuthMessage{RoomID: reg.NewRoom(newKey()), Name: "Dave", ClientKey: newKey(), Invite: invite.Token})
+	assert.Equal(t, ErrNotAValidInvite.Error(), readMsg(t, other).Payload)
+}
+
+func TestInviteExpired(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey)
+
+	invite, err := reg.NewInvite(roomID, mgtKey, time.Second, 0)
+	assert.NoError(t, err)
+	time.Sleep(1100 * time.Millisecond)
+
+	alice := dial(t, url, kecpmsg.AuthMessage{Name: "Alice", ClientKey: newKey(), Invite: invite.Token})
+	assert.Equal(t, ErrInviteExpired.Error(), readMsg(t, alice).Payload)
+}
+
+func TestInviteForged(t *testing.T) {
+	reg := NewRegistry(WithInviteSecret([]byte("secret")))
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey)
+
+	forger := NewRegistry(WithInviteSecret([]byte("guess")))
+	forgerRoomID := forger.NewRoom(mgtKey)
+	invite, err := forger.NewInvite(forgerRoomID, mgtKey, time.Minute, 0)
+	assert.NoError(t, err)
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: newKey(), Invite: invite.Token})
+	assert.Equal(t, ErrNotAValidInvite.Error(), readMsg(t, alice).Payload)
+
+	bob := dial(t, url, kecpmsg.AuthMessage{Name: "Bob", ClientKey: newKey(), Invite: "garbage"})
+	assert.Equal(t, ErrNotAValidInvite.Error(), readMsg(t, bob).Payload)
+}
+
+func TestInviteInLobby(t *testing.T) {
+	reg := NewRegistry(WithInviteSecret([]byte("secret")))
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey, WithMaxMembers(2))
+	invite, err := reg.NewInvite(roomID, mgtKey, time.Minute, 1)
+	assert.NoError(t, err)
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	readMsgOfType(t, alice, kecpmsg.Session)
+	dave := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Dave", ClientKey: newKey()})
+	readMsgOfType(t, dave, kecpmsg.Session)
+
+	// Waiting in the lobby does not use the invite.
+	bob := dial(t, url, kecpmsg.AuthMessage{Name: "Bob", ClientKey: newKey(), Invite: invite.Token})
+	assert.Equal(t, 1.0, readMsgOfType(t, bob, kecpmsg.Lobby).Payload)
+	carol := dial(t, url, kecpmsg.AuthMessage{Name: "Carol", ClientKey: newKey(), Invite: invite.Token})
+	assert.Equal(t, 2.0, readMsgOfType(t, carol, kecpmsg.Lobby).Payload)
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Reject, Name: "Alice", Payload: "Bob"})
+	assert.Equal(t, 1.0, readMsgOfType(t, carol, kecpmsg.Lobby).Payload)
+
+	// Joining does.
+	dave.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	assert.Equal(t, kecpmsg.List, readMsgOfType(t, carol, kecpmsg.List).Type)
+	eve := dial(t, url, kecpmsg.AuthMessage{Name: "Eve", ClientKey: newKey(), Invite: invite.Token})
+	assert.Equal(t, ErrInviteExhausted.Error(), readMsgOfType(t, eve, kecpmsg.Error).Payload)
+}
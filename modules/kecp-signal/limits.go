@@ -0,0 +1,91 @@
+package kecpsignal
+
+import (
+	"time"
+)
+
+// Limits bound the rooms and the clients of the registry.
+// They may change while the registry runs.
+type Limits struct {
+	// The rooms created on this node, 0 for unlimited.
+	MaxRooms int
+
+	// The member count of the rooms, which may ask for fewer, 0 for unlimited.
+	MaxMembers int
+
+	// The messages each client may send per second, 0 for unlimited.
+	MessagesPerSecond int
+}
+
+// WithLimits sets the limits of the registry, none by default.
+func WithLimits(limits Limits) RegistryOption {
+	return func(reg *Registry) {
+		reg.limits.Store(&limits)
+	}
+}
+
+// SetLimits changes the limits of the registry. The rooms already over
+// them are left alone, but the new rooms, the new settings of the rooms
+// and the messages from now on are held to them.
+func (reg *Registry) SetLimits(limits Limits) {
+	reg.limits.Store(&limits)
+}
+
+// Limits returns the limits of the registry.
+func (reg *Registry) Limits() Limits {
+	return *reg.limits.Load()
+}
+
+// capMembers returns the member count of a room asking for maxMembers,
+// 0 or less for no preference, within the limit.
+func (limits Limits) capMembers(maxMembers int) int {
+	if limits.MaxMembers > 0 && (maxMembers <= 0 || maxMembers > limits.MaxMembers) {
+		return limits.MaxMembers
+	}
+	return maxMembers
+}
+
+// isOverRoomCap reports whether the registry has as many rooms of its own
+// as the limit allows. Only the run goroutine of the registry can call it.
+func (reg *Registry) isOverRoomCap() bool {
+	maxRooms := reg.Limits().MaxRooms
+	if maxRooms <= 0 {
+		return false
+	}
+	count := 0
+	for _, room := range reg.rooms {
+		if !room.replica {
+			count++
+		}
+	}
+	return count >= maxRooms
+}
+
+// messageBucket lets a client send a second's worth of messages at once,
+// refilled at the rate allowed.
+// Only the client's readPump goroutine can access it.
+type messageBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take reports whether the message may pass at the rate, 0 for unlimited.
+func (b *messageBucket) take(rate int, now time.Time) bool {
+	if rate <= 0 {
+		return true
+	}
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * float64(rate)
+	} else {
+		b.tokens = float64(rate)
+	}
+	if b.tokens > float64(rate) {
+		b.tokens = float64(rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
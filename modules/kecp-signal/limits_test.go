@@ -0,0 +1,81 @@
+package kecpsignal_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoomCap(t *testing.T) {
+	reg := NewRegistry(WithLimits(Limits{MaxRooms: 1}))
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey)
+	assert.NotEmpty(t, roomID)
+	assert.Empty(t, reg.NewRoom(newKey()))
+
+	// The limit changes while the registry runs.
+	reg.SetLimits(Limits{MaxRooms: 2})
+	assert.NotEmpty(t, reg.NewRoom(newKey()))
+	assert.Equal(t, 2, reg.Limits().MaxRooms)
+
+	assert.NoError(t, reg.DeleteRoom(roomID, mgtKey))
+	assert.Eventually(t, func() bool {
+		return reg.NewRoom(newKey()) != ""
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMemberCap(t *testing.T) {
+	reg := NewRegistry(WithLimits(Limits{MaxMembers: 5}))
+	mgtKey := newKey()
+	for _, tt := range []struct {
+		asked int
+		want  int
+	}{
+		{0, 5},
+		{3, 3},
+		{8, 5},
+	} {
+		info, err := reg.RoomInfo(reg.NewRoom(mgtKey, WithMaxMembers(tt.asked)), mgtKey)
+		if assert.NoError(t, err) {
+			assert.Equal(t, tt.want, info.MaxMembers)
+		}
+	}
+
+	roomID := reg.NewRoom(mgtKey)
+	maxMembers := 10
+	info, err := reg.UpdateRoomSettings(roomID, mgtKey, RoomSettings{MaxMembers: &maxMembers})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5, info.MaxMembers)
+	}
+}
+
+func TestMessageRate(t *testing.T) {
+	reg := NewRegistry(WithLimits(Limits{MessagesPerSecond: 5}))
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey)
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	readSession(t, alice)
+
+	// Only a second's worth of the burst passes.
+	for i := 0; i < 10; i++ {
+		writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Chat, Name: "Alice", Payload: "spam"})
+	}
+	chats := 0
+	for {
+		alice.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		_, b, err := alice.ReadMessage()
+		if err != nil {
+			break
+		}
+		var msg kecpmsg.Message
+		if json.Unmarshal(b, &msg) == nil && msg.Type == kecpmsg.Chat {
+			chats++
+		}
+	}
+	assert.Equal(t, 5, chats)
+}
@@ -0,0 +1,115 @@
+package kecpsignal
+
+import (
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+)
+
+// lobby holds the clients waiting for a place in the full room.
+type lobby struct {
+	// The waiting clients, in order.
+	waiting []*Client
+}
+
+// find returns the waiting client with the name, nil if there is none.
+func (l *lobby) find(name string) *Client {
+	for _, waiting := range l.waiting {
+		if waiting.name == name {
+			return waiting
+		}
+	}
+	return nil
+}
+
+// remove takes the client out of the queue, and reports whether it was waiting.
+func (l *lobby) remove(client *Client) bool {
+	for i, waiting := range l.waiting {
+		if waiting == client {
+			l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// isFull reports whether the room reached its maximum member count.
+func (room *Room) isFull() bool {
+	return room.maxMembers > 0 && len(room.clients)+len(room.sessions.away)+len(room.remoteMembers) >= room.maxMembers
+}
+
+// enqueue puts the client in the lobby until it is admitted.
+func enqueue(room *Room, client *Client) {
+	room.lobby.waiting = append(room.lobby.waiting, client)
+	notifyLobby(room)
+}
+
+// replaceInLobby replaces the waiting client with the same key, keeping its position.
+func replaceInLobby(room *Room, client *Client) bool {
+	for i, waiting := range room.lobby.waiting {
+		if waiting.clientKey == client.clientKey {
+			waiting.left = true
+			closeClient(waiting)
+			room.lobby.waiting[i] = client
+			sendToSingleClient(room, client, kecpmsg.NewLobbyMsg(i+1))
+			return true
+		}
+	}
+	return false
+}
+
+func findWaitingClientByName(room *Room, name string) *Client {
+	return room.lobby.find(name)
+}
+
+// removeFromLobby removes the client from the lobby without closing it.
+func removeFromLobby(room *Room, client *Client) bool {
+	if !room.lobby.remove(client) {
+		return false
+	}
+	notifyLobby(room)
+	return true
+}
+
+// admitFromLobby lets the waiting clients in while there is room for them.
+func admitFromLobby(room *Room) {
+	for len(room.lobby.waiting) > 0 && !room.isFull() {
+		client := room.lobby.waiting[0]
+		room.lobby.waiting = room.lobby.waiting[1:]
+		if client.closed {
+			continue
+		}
+		if room.isBanned(client) {
+			dismissWaiting(room, client, ErrBannedFromTheRoom)
+			notifyLobby(room)
+			continue
+		}
+		// The invite may have been used up while the client waited.
+		if err := checkInvite(room, client); err != nil {
+			dismissWaiting(room, client, err)
+			notifyLobby(room)
+			continue
+		}
+		join(room, client)
+		notifyLobby(room)
+	}
+}
+
+// dismissWaiting tells the client, out of the lobby, why it is not let in.
+func dismissWaiting(room *Room, client *Client, err error) {
+	sendToSingleClient(room, client, kecpmsg.NewErrorMsg(err))
+	client.left = true
+	closeClient(client)
+}
+
+// notifyLobby tells the waiting clients their position and the moderator the queue.
+func notifyLobby(room *Room) {
+	waiting := make([]string, 0, len(room.lobby.waiting))
+	for i, client := range room.lobby.waiting {
+		sendToSingleClient(room, client, kecpmsg.NewLobbyMsg(i+1))
+		waiting = append(waiting, client.name)
+	}
+	for _, client := range room.clients {
+		if room.isModerator(client) {
+			sendToSingleClient(room, client, kecpmsg.NewLobbyQueueMsg(waiting))
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package kecpsignal_test
+
+import (
+	"testing"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLobby(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey, WithMaxMembers(2))
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	readMsgOfType(t, alice, kecpmsg.Session)
+	bob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: newKey()})
+	readMsgOfType(t, bob, kecpmsg.Session)
+
+	carol := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Carol", ClientKey: newKey()})
+	assert.Equal(t, &kecpmsg.Message{Type: kecpmsg.Lobby, Payload: 1.0}, stripServerTime(readMsg(t, carol)))
+	assert.Equal(t, []interface{}{"Carol"}, readMsgOfType(t, alice, kecpmsg.LobbyQueue).Payload)
+	dave := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Dave", ClientKey: newKey()})
+	assert.Equal(t, 2.0, readMsgOfType(t, dave, kecpmsg.Lobby).Payload)
+	assert.Equal(t, []interface{}{"Carol", "Dave"}, readMsgOfType(t, alice, kecpmsg.LobbyQueue).Payload)
+
+	// The waiting clients cannot talk to the room.
+	writeMsg(t, carol, &kecpmsg.Message{Type: kecpmsg.Chat, Name: "Carol", Payload: "let me in"})
+
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Reject, Name: "Alice", Payload: "Carol"})
+	assert.Equal(t, ErrRejectedByTheModerator.Error(), readMsgOfType(t, carol, kecpmsg.Error).Payload)
+	assert.Equal(t, 1.0, readMsgOfType(t, dave, kecpmsg.Lobby).Payload)
+
+	// A place is freed for the first waiting client.
+	bob.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	assert.Equal(t, kecpmsg.List, readMsgOfType(t, dave, kecpmsg.List).Type)
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Leave).Payload)
+	for {
+		msg := readMsg(t, alice)
+		assert.NotEqual(t, kecpmsg.Chat, msg.Type)
+		if msg.Type == kecpmsg.Join {
+			assert.Equal(t, "Dave", msg.Payload)
+			break
+		}
+	}
+
+	info, err := reg.RoomInfo(roomID, mgtKey)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, info.Members)
+	assert.Equal(t, 0, info.Waiting)
+	assert.Equal(t, 2, info.MaxMembers)
+}
+
+func TestLobbyAdmission(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey, WithMaxMembers(1))
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	readMsgOfType(t, alice, kecpmsg.Session)
+	bob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: newKey()})
+	assert.Equal(t, 1.0, readMsgOfType(t, bob, kecpmsg.Lobby).Payload)
+
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Admit, Name: "Alice", Payload: "Bob"})
+	assert.ElementsMatch(t, []interface{}{"Alice", "Bob"}, readMsgOfType(t, bob, kecpmsg.List).Payload)
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Join).Payload)
+}
+
+func stripServerTime(msg *kecpmsg.Message) *kecpmsg.Message {
+	msg.ServerTime = 0
+	return msg
+}
+
+func TestLobbyBan(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey, WithMaxMembers(2))
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	readMsgOfType(t, alice, kecpmsg.Session)
+	bob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: newKey()})
+	readMsgOfType(t, bob, kecpmsg.Session)
+	mallory := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Mallory", ClientKey: newKey()})
+	assert.Equal(t, 1.0, readMsgOfType(t, mallory, kecpmsg.Lobby).Payload)
+	carol := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Carol", ClientKey: newKey()})
+	assert.Equal(t, 2.0, readMsgOfType(t, carol, kecpmsg.Lobby).Payload)
+
+	// The banned client leaves the lobby at once.
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Ban, Name: "Alice", Payload: kecpmsg.BanTarget{Name: "Mallory"}})
+	assert.Equal(t, ErrBannedFromTheRoom.Error(), readMsgOfType(t, mallory, kecpmsg.Error).Payload)
+	assert.Equal(t, 1.0, readMsgOfType(t, carol, kecpmsg.Lobby).Payload)
+
+	// The place freed goes to the next client instead.
+	bob.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	assert.Equal(t, kecpmsg.List, readMsgOfType(t, carol, kecpmsg.List).Type)
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Leave).Payload)
+	assert.Equal(t, "Carol", readMsgOfType(t, alice, kecpmsg.Join).Payload)
+	info, err := reg.RoomInfo(roomID, mgtKey)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, info.Members)
+	assert.Equal(t, 0, info.Waiting)
+}
+
+func TestAwayBan(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey, WithMaxMembers(2))
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	readMsgOfType(t, alice, kecpmsg.Session)
+	mallory := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Mallory", ClientKey: newKey()})
+	readMsgOfType(t, mallory, kecpmsg.Session)
+	assert.Equal(t, "Mallory", readMsgOfType(t, alice, kecpmsg.Join).Payload)
+	mallory.UnderlyingConn().Close()
+	carol := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Carol", ClientKey: newKey()})
+	assert.Equal(t, 1.0, readMsgOfType(t, carol, kecpmsg.Lobby).Payload)
+
+	// The away client gives its place up without waiting for the grace period.
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Ban, Name: "Alice", Payload: kecpmsg.BanTarget{Name: "Mallory"}})
+	assert.Equal(t, "Mallory", readMsgOfType(t, alice, kecpmsg.Leave).Payload)
+	assert.Equal(t, kecpmsg.List, readMsgOfType(t, carol, kecpmsg.List).Type)
+}
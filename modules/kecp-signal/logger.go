@@ -1,17 +1,117 @@
 package kecpsignal
 
 import (
-	stdlog "log"
+	"bytes"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"sync/atomic"
 )
 
+// Logger prints lines, such as *log.Logger.
 type Logger interface {
 	Print(v ...any)
 	Printf(format string, v ...any)
 	Println(v ...any)
 }
 
-var logger Logger = stdlog.Default()
+// LeveledLogger logs events with alternating keys and values,
+// such as *slog.Logger.
+type LeveledLogger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// defaultLogger logs for the registries made without WithLogger.
+// It may be replaced while the rooms log.
+var defaultLogger atomic.Pointer[leveledLogger]
+
+// leveledLogger boxes a LeveledLogger for defaultLogger.
+type leveledLogger struct {
+	LeveledLogger
+}
 
+func init() {
+	SetLeveledLogger(slog.Default())
+}
+
+// SetLogger prints the events from the info level on with the logger,
+// formatted as key=value pairs.
 func SetLogger(newLogger Logger) {
-	logger = newLogger
+	SetLeveledLogger(PrintingLogger(newLogger))
+}
+
+// SetLeveledLogger logs with the logger, such as slog.New(slog.NewJSONHandler(os.Stderr, nil)).
+func SetLeveledLogger(newLogger LeveledLogger) {
+	defaultLogger.Store(&leveledLogger{newLogger})
+}
+
+// WithLogger logs the events of the registry with the logger,
+// instead of the one set with SetLogger or SetLeveledLogger.
+func WithLogger(logger LeveledLogger) RegistryOption {
+	return func(reg *Registry) {
+		reg.logger = logger
+	}
+}
+
+// PrintingLogger prints the events from the info level on with the logger,
+// formatted as key=value pairs.
+func PrintingLogger(logger Logger) LeveledLogger {
+	return slog.New(slog.NewTextHandler(printer{logger}, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			// The logger has its own timestamp.
+			if len(groups) == 0 && attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+}
+
+// Logger returns the logger of the registry's events.
+func (reg *Registry) Logger() LeveledLogger {
+	return reg.log()
+}
+
+// log returns the logger of the registry.
+func (reg *Registry) log() LeveledLogger {
+	if reg.logger != nil {
+		return reg.logger
+	}
+	return defaultLogger.Load().LeveledLogger
+}
+
+// printer writes each line of a slog handler with a Logger.
+type printer struct {
+	logger Logger
+}
+
+func (p printer) Write(b []byte) (int, error) {
+	p.logger.Print(string(bytes.TrimSuffix(b, newline)))
+	return len(b), nil
+}
+
+// fingerprint identifies the key in the logs without revealing it.
+func fingerprint(key string) string {
+	return hex.EncodeToString(hashKey(key)[:8])
+}
+
+// remoteAddr returns the address of the peer, if the connection knows it.
+func remoteAddr(conn WebscoketConn) string {
+	if conn, ok := conn.(interface{ RemoteAddr() net.Addr }); ok {
+		return conn.RemoteAddr().String()
+	}
+	return ""
+}
+
+// clientAttrs returns the attributes identifying the client in the logs.
+func clientAttrs(client *Client, args ...any) []any {
+	return append([]any{
+		"room", client.room.RoomID,
+		"name", client.name,
+		"key", fingerprint(client.clientKey),
+		"addr", client.remoteAddr,
+	}, args...)
 }
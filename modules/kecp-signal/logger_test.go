@@ -1,12 +1,82 @@
 package kecpsignal_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"log"
+	"log/slog"
+	"sync"
 	"testing"
 
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
 	. "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/stretchr/testify/assert"
 )
 
+// logBuffer collects the logs written by the rooms.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func (b *logBuffer) String() string {
+	return string(b.Bytes())
+}
+
 func TestSetLogger(t *testing.T) {
+	t.Cleanup(func() { SetLeveledLogger(slog.Default()) })
 	SetLogger(log.Default())
 }
+
+func TestPrintedEvents(t *testing.T) {
+	var b logBuffer
+	reg := NewRegistry(WithLogger(PrintingLogger(log.New(&b, "", 0))))
+	url := newTestServer(t, reg)
+	roomID := reg.NewRoom(newKey())
+	mallory := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Mallory", ClientKey: "short"})
+	assert.Equal(t, ErrNotAValidKey.Error(), readMsg(t, mallory).Payload)
+
+	assert.Contains(t, b.String(), "level=INFO msg=\"room created\" room="+roomID)
+	assert.Contains(t, b.String(), "level=WARN msg=\"auth failed\"")
+	assert.Contains(t, b.String(), "error=\"not a valid key\"")
+	assert.NotContains(t, b.String(), "time=")
+}
+
+func TestStructuredEvents(t *testing.T) {
+	var b logBuffer
+	reg := NewRegistry(WithLogger(slog.New(slog.NewJSONHandler(&b, nil))))
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey)
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	assert.Equal(t, kecpmsg.List, readMsg(t, alice).Type)
+
+	var joined map[string]interface{}
+	for _, line := range bytes.Split(b.Bytes(), []byte("\n")) {
+		var event map[string]interface{}
+		if json.Unmarshal(line, &event) == nil && event["msg"] == "client joined" {
+			joined = event
+		}
+	}
+	if !assert.NotNil(t, joined) {
+		t.FailNow()
+	}
+	assert.Equal(t, "INFO", joined["level"])
+	assert.Equal(t, roomID, joined["room"])
+	assert.Equal(t, "Alice", joined["name"])
+	assert.Len(t, joined["key"], 16)
+	assert.NotContains(t, b.String(), mgtKey)
+	assert.Contains(t, joined["addr"], "127.0.0.1:")
+}
@@ -0,0 +1,108 @@
+package kecpsignal
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "kecp"
+
+var (
+	metrics = prometheus.NewRegistry()
+
+	roomsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "rooms",
+		Help:      "Rooms served by this node, including the ones created on other nodes.",
+	})
+	clientsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "clients",
+		Help:      "Clients connected to this node.",
+	})
+	roomsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rooms_created_total",
+		Help:      "Rooms created on this node.",
+	})
+	roomsDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rooms_deleted_total",
+		Help:      "Rooms created on this node and deleted since.",
+	})
+	joins = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "joins_total",
+		Help:      "Members joining a room on this node.",
+	})
+	leaves = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "leaves_total",
+		Help:      "Members leaving a room on this node.",
+	})
+	messages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_total",
+		Help:      "Messages received from the clients by type.",
+	}, []string{"type"})
+	authFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "auth_failures_total",
+		Help:      "Clients refused on auth by error.",
+	}, []string{"error"})
+	slowConsumerDrops = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "slow_consumer_drops_total",
+		Help:      "Clients closed because their send buffer was full.",
+	})
+	rateLimitedMessages = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rate_limited_messages_total",
+		Help:      "Messages from the clients dropped because they came too fast.",
+	})
+	brokerEventDrops = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "broker_event_drops_total",
+		Help:      "Events for the other nodes dropped because the outbox of their room was full.",
+	})
+	fanOutDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "fan_out_duration_seconds",
+		Help:      "Time taken to hand a message over to the members of the room and the other nodes.",
+		// From 10µs to about 0.3s.
+		Buckets: prometheus.ExponentialBuckets(0.00001, 2, 16),
+	}, []string{"type"})
+)
+
+func init() {
+	metrics.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		roomsGauge,
+		clientsGauge,
+		roomsCreated,
+		roomsDeleted,
+		joins,
+		leaves,
+		messages,
+		authFailures,
+		slowConsumerDrops,
+		rateLimitedMessages,
+		brokerEventDrops,
+		fanOutDuration,
+	)
+}
+
+// MetricsHandler serves the metrics of the rooms and the clients
+// in the Prometheus text format.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metrics, promhttp.HandlerOpts{})
+}
+
+// MustRegisterMetrics serves the collectors along with the metrics of the rooms and the clients.
+func MustRegisterMetrics(collectors ...prometheus.Collector) {
+	metrics.MustRegister(collectors...)
+}
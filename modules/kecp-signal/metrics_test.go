@@ -0,0 +1,82 @@
+package kecpsignal_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+// scrape returns the value of the metric having the label, if any.
+func scrape(t *testing.T, name string, label ...string) float64 {
+	w := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	families, err := new(expfmt.TextParser).TextToMetricFamilies(w.Body)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	family, ok := families[name]
+	if !ok {
+		return 0
+	}
+	for _, metric := range family.Metric {
+		if len(label) == 2 && !hasLabel(metric, label[0], label[1]) {
+			continue
+		}
+		switch {
+		case metric.Gauge != nil:
+			return metric.Gauge.GetValue()
+		case metric.Counter != nil:
+			return metric.Counter.GetValue()
+		case metric.Histogram != nil:
+			return float64(metric.Histogram.GetSampleCount())
+		}
+	}
+	return 0
+}
+
+func hasLabel(metric *dto.Metric, name string, value string) bool {
+	for _, pair := range metric.Label {
+		if pair.GetName() == name && pair.GetValue() == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMetrics(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+
+	// The clients left by the other tests may still be counted.
+	roomsCreated := scrape(t, "kecp_rooms_created_total")
+	joins := scrape(t, "kecp_joins_total")
+	chats := scrape(t, "kecp_messages_total", "type", string(kecpmsg.Chat))
+	invalidKeys := scrape(t, "kecp_auth_failures_total", "error", ErrNotAValidKey.Error())
+	chatFanOuts := scrape(t, "kecp_fan_out_duration_seconds", "type", string(kecpmsg.Chat))
+
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey)
+	assert.Equal(t, roomsCreated+1, scrape(t, "kecp_rooms_created_total"))
+	assert.GreaterOrEqual(t, scrape(t, "kecp_rooms"), 1.0)
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	assert.Equal(t, kecpmsg.List, readMsg(t, alice).Type)
+	bob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: newKey()})
+	assert.Equal(t, kecpmsg.List, readMsg(t, bob).Type)
+	assert.GreaterOrEqual(t, scrape(t, "kecp_joins_total"), joins+2)
+	assert.GreaterOrEqual(t, scrape(t, "kecp_clients"), 2.0)
+
+	writeMsg(t, bob, &kecpmsg.Message{Type: kecpmsg.Chat, Name: "Bob", Payload: "hello"})
+	readMsgOfType(t, alice, kecpmsg.Chat)
+	assert.GreaterOrEqual(t, scrape(t, "kecp_messages_total", "type", string(kecpmsg.Chat)), chats+1)
+	assert.GreaterOrEqual(t, scrape(t, "kecp_fan_out_duration_seconds", "type", string(kecpmsg.Chat)), chatFanOuts+1)
+
+	mallory := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Mallory", ClientKey: "short"})
+	assert.Equal(t, ErrNotAValidKey.Error(), readMsg(t, mallory).Payload)
+	assert.GreaterOrEqual(t, scrape(t, "kecp_auth_failures_total", "error", ErrNotAValidKey.Error()), invalidKeys+1)
+}
@@ -0,0 +1,259 @@
+package kecpsignal
+
+import (
+	"bytes"
+
+	kecpbroker "github.com/fourdim/kecp/modules/kecp-broker"
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+)
+
+type moderation struct {
+	moderator *Client
+	message   *kecpmsg.Message
+}
+
+// sanctions holds who is banned or muted in the room.
+type sanctions struct {
+	// Banned usernames and hashes of the client keys.
+	bannedNames map[string]bool
+	bannedKeys  map[string]bool
+
+	// Usernames whose chat messages are dropped.
+	mutedNames map[string]bool
+}
+
+func newSanctions() sanctions {
+	return sanctions{
+		bannedNames: make(map[string]bool),
+		bannedKeys:  make(map[string]bool),
+		mutedNames:  make(map[string]bool),
+	}
+}
+
+// isModerator reports whether the client created the room.
+func (room *Room) isModerator(client *Client) bool {
+	return room.isManager(client.clientKey)
+}
+
+func (room *Room) isBanned(client *Client) bool {
+	return room.sanctions.bannedNames[client.name] || room.sanctions.bannedKeys[string(hashKey(client.clientKey))]
+}
+
+// isMutedChat reports whether the message is a chat message from a muted client.
+// The sender is told that the message is dropped.
+func isMutedChat(room *Room, message *kecpmsg.Message) bool {
+	if message.Type != kecpmsg.Chat || !room.sanctions.mutedNames[message.Name] {
+		return false
+	}
+	if sender := findClientByName(room, message.Name); sender != nil {
+		sendToSingleClient(room, sender, kecpmsg.NewErrorMsg(ErrMutedInTheRoom))
+	}
+	return true
+}
+
+// moderate applies a moderator command and broadcasts a notice about it.
+func moderate(room *Room, moderation *moderation) {
+	moderator, message := moderation.moderator, moderation.message
+	if room.clients[moderator.clientKey] != moderator {
+		return
+	}
+	if !room.isModerator(moderator) {
+		sendToSingleClient(room, moderator, kecpmsg.NewErrorMsg(ErrNotTheModerator))
+		return
+	}
+	switch message.Type {
+	case kecpmsg.Kick:
+		name := message.Payload.(string)
+		target := findClientByName(room, name)
+		_, remote := room.remoteMembers[name]
+		if (target == nil && !remote) || target == moderator {
+			sendToSingleClient(room, moderator, kecpmsg.NewErrorMsg(ErrUserNotFound))
+			return
+		}
+		broadcast(room, kecpmsg.NewModerationMsg(moderator.name, kecpmsg.Kick, name))
+		if target == nil {
+			// The node of the member expels it.
+			publish(room, &kecpbroker.Event{Type: kecpbroker.Expel, Name: name})
+			return
+		}
+		expel(room, target)
+	case kecpmsg.Ban:
+		banTarget := message.Payload.(kecpmsg.BanTarget)
+		if banTarget.ClientKey == moderator.clientKey || banTarget.Name == moderator.name {
+			return
+		}
+		change := &kecpbroker.ModerationState{}
+		if banTarget.ClientKey != "" {
+			change.BannedKeyHashes = append(change.BannedKeyHashes, hashKey(banTarget.ClientKey))
+		}
+		if banTarget.Name != "" {
+			change.BannedNames = append(change.BannedNames, banTarget.Name)
+		}
+		name := banTarget.Name
+		// The target may be known by name only, ban the key as well.
+		if memberName, keyHash, ok := findBannedMember(room, change); ok {
+			name = memberName
+			change.BannedKeyHashes = append(change.BannedKeyHashes, keyHash)
+		}
+		broadcast(room, kecpmsg.NewModerationMsg(moderator.name, kecpmsg.Ban, name))
+		shareModeration(room, change)
+		expelBanned(room)
+	case kecpmsg.Mute:
+		name := message.Payload.(string)
+		if name == moderator.name {
+			return
+		}
+		shareModeration(room, &kecpbroker.ModerationState{MutedNames: []string{name}})
+		broadcast(room, kecpmsg.NewModerationMsg(moderator.name, kecpmsg.Mute, name))
+	case kecpmsg.Unmute:
+		name := message.Payload.(string)
+		shareModeration(room, &kecpbroker.ModerationState{UnmutedNames: []string{name}})
+		broadcast(room, kecpmsg.NewModerationMsg(moderator.name, kecpmsg.Unmute, name))
+	case kecpmsg.Admit:
+		target := findWaitingClientByName(room, message.Payload.(string))
+		if target == nil {
+			sendToSingleClient(room, moderator, kecpmsg.NewErrorMsg(ErrUserNotFound))
+			return
+		}
+		// The moderator may admit beyond the maximum member count.
+		removeFromLobby(room, target)
+		join(room, target)
+	case kecpmsg.Reject:
+		target := findWaitingClientByName(room, message.Payload.(string))
+		if target == nil {
+			sendToSingleClient(room, moderator, kecpmsg.NewErrorMsg(ErrUserNotFound))
+			return
+		}
+		removeFromLobby(room, target)
+		dismissWaiting(room, target, ErrRejectedByTheModerator)
+	}
+}
+
+// expel removes the client from the room and tells the others it left.
+func expel(room *Room, client *Client) {
+	room.registry.log().Info("client expelled", clientAttrs(client)...)
+	delete(room.clients, client.clientKey)
+	closeClient(client)
+	client.left = true
+	broadcast(room, kecpmsg.NewLeaveMsg(client.name, client.clientKey))
+	replan(room)
+}
+
+// findBannedMember finds the member, on this node or another, whose name
+// or key is banned by the change, and returns its name and key hash.
+func findBannedMember(room *Room, change *kecpbroker.ModerationState) (string, []byte, bool) {
+	isBanned := func(name string, keyHash []byte) bool {
+		for _, bannedName := range change.BannedNames {
+			if name == bannedName {
+				return true
+			}
+		}
+		for _, bannedKeyHash := range change.BannedKeyHashes {
+			if bytes.Equal(keyHash, bannedKeyHash) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, client := range append(room.members(), room.lobby.waiting...) {
+		if keyHash := hashKey(client.clientKey); isBanned(client.name, keyHash) {
+			return client.name, keyHash, true
+		}
+	}
+	for name, member := range room.remoteMembers {
+		if isBanned(name, member.keyHash) {
+			return name, member.keyHash, true
+		}
+	}
+	return "", nil, false
+}
+
+// expelBanned expels the clients whose name or key is banned, whether they
+// are registered, away or waiting in the lobby.
+func expelBanned(room *Room) {
+	for _, client := range room.members() {
+		switch {
+		case !room.isBanned(client):
+		case room.sessions.isAway(client):
+			dismissAway(room, client)
+		default:
+			expel(room, client)
+		}
+	}
+	for _, client := range append([]*Client(nil), room.lobby.waiting...) {
+		if room.isBanned(client) {
+			removeFromLobby(room, client)
+			dismissWaiting(room, client, ErrBannedFromTheRoom)
+		}
+	}
+}
+
+// shareModeration applies the changes to the bans, the mutes and the
+// invite uses, and tells the other nodes about them.
+func shareModeration(room *Room, change *kecpbroker.ModerationState) {
+	applyModeration(room, change)
+	publish(room, &kecpbroker.Event{Type: kecpbroker.Moderation, Moderation: change})
+}
+
+// applyModeration applies the changes to the bans, the mutes and the invite uses.
+func applyModeration(room *Room, change *kecpbroker.ModerationState) {
+	for _, name := range change.BannedNames {
+		room.sanctions.bannedNames[name] = true
+	}
+	for _, keyHash := range change.BannedKeyHashes {
+		room.sanctions.bannedKeys[string(keyHash)] = true
+	}
+	for _, name := range change.MutedNames {
+		room.sanctions.mutedNames[name] = true
+	}
+	for _, name := range change.UnmutedNames {
+		delete(room.sanctions.mutedNames, name)
+	}
+	for inviteID, keyHashes := range change.InviteUses {
+		users, ok := room.inviteUses[inviteID]
+		if !ok {
+			users = make(map[string]bool)
+			room.inviteUses[inviteID] = users
+		}
+		for _, keyHash := range keyHashes {
+			users[string(keyHash)] = true
+		}
+	}
+	if len(change.InviteUses) > 0 {
+		saveRoom(room)
+	}
+}
+
+// moderationState returns the bans, the mutes and the invite uses of the room,
+// nil if there are none.
+func moderationState(room *Room) *kecpbroker.ModerationState {
+	if len(room.sanctions.bannedNames) == 0 && len(room.sanctions.bannedKeys) == 0 && len(room.sanctions.mutedNames) == 0 && len(room.inviteUses) == 0 {
+		return nil
+	}
+	state := &kecpbroker.ModerationState{InviteUses: inviteUseHashes(room)}
+	for name := range room.sanctions.bannedNames {
+		state.BannedNames = append(state.BannedNames, name)
+	}
+	for keyHash := range room.sanctions.bannedKeys {
+		state.BannedKeyHashes = append(state.BannedKeyHashes, []byte(keyHash))
+	}
+	for name := range room.sanctions.mutedNames {
+		state.MutedNames = append(state.MutedNames, name)
+	}
+	return state
+}
+
+// inviteUseHashes returns the key hashes of the clients which joined with
+// each invite, nil if there are none.
+func inviteUseHashes(room *Room) map[string][][]byte {
+	if len(room.inviteUses) == 0 {
+		return nil
+	}
+	uses := make(map[string][][]byte, len(room.inviteUses))
+	for inviteID, users := range room.inviteUses {
+		for keyHash := range users {
+			uses[inviteID] = append(uses[inviteID], []byte(keyHash))
+		}
+	}
+	return uses
+}
@@ -0,0 +1,60 @@
+package kecpsignal_test
+
+import (
+	"testing"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModeration(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey)
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	readMsgOfType(t, alice, kecpmsg.List)
+	bob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: newKey()})
+	readMsgOfType(t, bob, kecpmsg.List)
+	malloryKey := newKey()
+	mallory := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Mallory", ClientKey: malloryKey})
+	readMsgOfType(t, mallory, kecpmsg.List)
+
+	// Only the creator can moderate.
+	writeMsg(t, mallory, &kecpmsg.Message{Type: kecpmsg.Kick, Name: "Mallory", Payload: "Alice"})
+	assert.Equal(t, ErrNotTheModerator.Error(), readMsgOfType(t, mallory, kecpmsg.Error).Payload)
+
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Mute, Name: "Alice", Payload: "Mallory"})
+	assert.Equal(t, "Mallory", readNotice(t, mallory, kecpmsg.Mute)["target"])
+	writeMsg(t, mallory, &kecpmsg.Message{Type: kecpmsg.Chat, Name: "Mallory", Payload: "spam"})
+	assert.Equal(t, ErrMutedInTheRoom.Error(), readMsgOfType(t, mallory, kecpmsg.Error).Payload)
+
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Kick, Name: "Alice", Payload: "Bob"})
+	assert.Equal(t, "Bob", readNotice(t, bob, kecpmsg.Kick)["target"])
+	_, _, err := bob.ReadMessage()
+	assert.Error(t, err)
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Leave).Payload)
+
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Ban, Name: "Alice", Payload: kecpmsg.BanTarget{Name: "Mallory"}})
+	assert.Equal(t, "Mallory", readNotice(t, mallory, kecpmsg.Ban)["target"])
+	assert.Equal(t, "Mallory", readMsgOfType(t, alice, kecpmsg.Leave).Payload)
+
+	// Bans hold for both the name and the key.
+	mallory = dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Eve", ClientKey: malloryKey})
+	assert.Equal(t, ErrBannedFromTheRoom.Error(), readMsgOfType(t, mallory, kecpmsg.Error).Payload)
+	mallory = dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Mallory", ClientKey: newKey()})
+	assert.Equal(t, ErrBannedFromTheRoom.Error(), readMsgOfType(t, mallory, kecpmsg.Error).Payload)
+}
+
+// readNotice skips the messages until a moderation notice about the action arrives.
+func readNotice(t *testing.T, conn *websocket.Conn, action kecpmsg.MsgType) map[string]interface{} {
+	for {
+		notice := readMsgOfType(t, conn, kecpmsg.Moderation).Payload.(map[string]interface{})
+		if notice["action"] == string(action) {
+			return notice
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package kecpsignal
+
+import (
+	"net"
+	"runtime"
+	"sync"
+	"time"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+)
+
+const (
+	// Time allowed to wait for a passphrase verification slot.
+	verificationWait = authWait
+
+	// Incorrect passphrases allowed from one address within the window.
+	maxPassphraseFailuresPerAddr = 20
+
+	// The window counting the incorrect passphrases of an address.
+	passphraseFailureWindow = 10 * time.Minute
+)
+
+// Passphrase verifications allowed to run at the same time.
+var maxConcurrentVerifications = runtime.NumCPU()
+
+// failureLimiter counts the recent failures of each address.
+type failureLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	failures map[string][]time.Time
+	swept    time.Time
+}
+
+func newFailureLimiter(max int, window time.Duration) *failureLimiter {
+	return &failureLimiter{
+		max:      max,
+		window:   window,
+		failures: make(map[string][]time.Time),
+	}
+}
+
+// allows reports whether the address has failures left.
+func (limiter *failureLimiter) allows(addr string, now time.Time) bool {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	return len(limiter.recent(addr, now)) < limiter.max
+}
+
+// fail records a failure of the address.
+func (limiter *failureLimiter) fail(addr string, now time.Time) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	limiter.failures[addr] = append(limiter.recent(addr, now), now)
+}
+
+// recent drops the failures out of the window and returns the rest.
+// The addresses without recent failures are swept once per window.
+func (limiter *failureLimiter) recent(addr string, now time.Time) []time.Time {
+	since := now.Add(-limiter.window)
+	if limiter.swept.Before(since) {
+		for other, failures := range limiter.failures {
+			if len(failures) == 0 || failures[len(failures)-1].Before(since) {
+				delete(limiter.failures, other)
+			}
+		}
+		limiter.swept = now
+	}
+	failures := limiter.failures[addr]
+	for len(failures) > 0 && failures[0].Before(since) {
+		failures = failures[1:]
+	}
+	if len(failures) == 0 {
+		delete(limiter.failures, addr)
+	}
+	return failures
+}
+
+// verifyPassphrase reports whether the passphrase lets a client from addr
+// into the room. The verifications are costly, so only a few run at once,
+// and an address with too many failures is refused without one.
+func (reg *Registry) verifyPassphrase(room *Room, passphrase string, addr string) (bool, error) {
+	if room.passphraseHash == nil {
+		return true, nil
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if !reg.passphraseFailures.allows(addr, time.Now()) {
+		return false, ErrTooManyPassphraseAttempts
+	}
+	timer := time.NewTimer(verificationWait)
+	defer timer.Stop()
+	select {
+	case reg.verifications <- struct{}{}:
+	case <-timer.C:
+		return false, ErrServerIsBusy
+	case <-reg.draining:
+		return false, ErrServerIsShuttingDown
+	}
+	verified := room.verifyPassphrase(passphrase)
+	<-reg.verifications
+	if !verified {
+		reg.passphraseFailures.fail(addr, time.Now())
+	}
+	return verified, nil
+}
+
+// passphraseRetry tells the client that the passphrase is incorrect, and
+// returns how long its next attempt is held back. Once the failures pile
+// up, the attempts are held back, and eventually refused.
+func passphraseRetry(conn WebscoketConn, failures int) (time.Duration, error) {
+	if failures >= maxPassphraseAttempts {
+		return 0, ErrTooManyPassphraseAttempts
+	}
+	if failures < passphraseAttemptsBeforeDelay {
+		writeErrorMsg(conn, ErrIncorrectPassphrase)
+		return 0, nil
+	}
+	writeErrorMsg(conn, ErrTooManyPassphraseAttempts)
+	return time.Duration(failures-passphraseAttemptsBeforeDelay+1) * passphraseRetryDelay, nil
+}
+
+type authRead struct {
+	auth *kecpmsg.AuthMessage
+	err  error
+}
+
+// readAuthMsgAfter reads the next auth message, but only hands it over
+// once the delay is over. The wait is cut short when the connection is
+// lost or the registry starts shutting down.
+func (reg *Registry) readAuthMsgAfter(conn WebscoketConn, delay time.Duration) (*kecpmsg.AuthMessage, error) {
+	if delay <= 0 {
+		return readAuthMsg(conn, authWait)
+	}
+	read := make(chan authRead, 1)
+	go func() {
+		auth, err := readAuthMsg(conn, delay+authWait)
+		read <- authRead{auth, err}
+	}()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case r := <-read:
+		if r.err != nil {
+			return nil, r.err
+		}
+		// Arrived early, held until the delay is over.
+		select {
+		case <-timer.C:
+			return r.auth, nil
+		case <-reg.draining:
+			return nil, ErrServerIsShuttingDown
+		}
+	case <-timer.C:
+		r := <-read
+		return r.auth, r.err
+	case <-reg.draining:
+		return nil, ErrServerIsShuttingDown
+	}
+}
@@ -0,0 +1,94 @@
+package kecpsignal_test
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPassphrase(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey, WithPassphrase("open sesame"))
+
+	info, err := reg.RoomInfo(roomID, mgtKey)
+	assert.NoError(t, err)
+	assert.True(t, info.Protected)
+
+	auth := kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: newKey(), Passphrase: "open"}
+	alice := dial(t, url, auth)
+	assert.Equal(t, ErrIncorrectPassphrase.Error(), readMsg(t, alice).Payload)
+	b, _ := json.Marshal(auth)
+	alice.WriteMessage(websocket.TextMessage, b)
+	assert.Equal(t, ErrIncorrectPassphrase.Error(), readMsg(t, alice).Payload)
+	alice.WriteMessage(websocket.TextMessage, b)
+	assert.Equal(t, ErrTooManyPassphraseAttempts.Error(), readMsg(t, alice).Payload)
+
+	// The next attempt is held back.
+	start := time.Now()
+	auth.Passphrase = "open sesame"
+	b, _ = json.Marshal(auth)
+	alice.WriteMessage(websocket.TextMessage, b)
+	assert.Equal(t, kecpmsg.List, readMsg(t, alice).Type)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestPassphraseNotGiven(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	roomID := reg.NewRoom(newKey(), WithPassphrase("open sesame"))
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: newKey()})
+	assert.Equal(t, ErrIncorrectPassphrase.Error(), readMsg(t, alice).Payload)
+}
+
+func TestPassphraseHoldAbortedOnClose(t *testing.T) {
+	var b logBuffer
+	reg := NewRegistry(WithLogger(slog.New(slog.NewTextHandler(&b, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	url := newTestServer(t, reg)
+	roomID := reg.NewRoom(newKey(), WithPassphrase("open sesame"))
+
+	auth := kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: newKey(), Passphrase: "open"}
+	alice := dial(t, url, auth)
+	payload, _ := json.Marshal(auth)
+	for i := 0; i < 2; i++ {
+		readMsg(t, alice)
+		alice.WriteMessage(websocket.TextMessage, payload)
+	}
+	assert.Equal(t, ErrTooManyPassphraseAttempts.Error(), readMsg(t, alice).Payload)
+
+	// The hold of the next attempt ends with the connection.
+	alice.Close()
+	assert.Eventually(t, func() bool {
+		return strings.Contains(b.String(), "error=\"connection lost\"")
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPassphraseFailuresPerAddr(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	roomID := reg.NewRoom(newKey(), WithPassphrase("open sesame"))
+
+	// Each connection gives up before its attempts are held back.
+	for i := 0; i < 10; i++ {
+		auth := kecpmsg.AuthMessage{RoomID: roomID, Name: "Mallory", ClientKey: newKey(), Passphrase: "open"}
+		mallory := dial(t, url, auth)
+		assert.Equal(t, ErrIncorrectPassphrase.Error(), readMsg(t, mallory).Payload)
+		b, _ := json.Marshal(auth)
+		mallory.WriteMessage(websocket.TextMessage, b)
+		assert.Equal(t, ErrIncorrectPassphrase.Error(), readMsg(t, mallory).Payload)
+		mallory.Close()
+	}
+
+	// Even the right passphrase is refused from the address now.
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: newKey(), Passphrase: "open sesame"})
+	assert.Equal(t, ErrTooManyPassphraseAttempts.Error(), readMsg(t, alice).Payload)
+}
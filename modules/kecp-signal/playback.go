@@ -0,0 +1,75 @@
+package kecpsignal
+
+import (
+	"time"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+)
+
+// playback is the room's authoritative playback state.
+// Only the room's run goroutine can access it.
+type playback struct {
+	// The media position in seconds at updatedAt.
+	position float64
+
+	paused bool
+
+	rate float64
+
+	updatedAt time.Time
+}
+
+func newPlayback(now time.Time) *playback {
+	return &playback{
+		position:  0,
+		paused:    true,
+		rate:      1,
+		updatedAt: now,
+	}
+}
+
+// positionAt extrapolates the media position to the given time.
+func (p *playback) positionAt(now time.Time) float64 {
+	if p.paused {
+		return p.position
+	}
+	return p.position + now.Sub(p.updatedAt).Seconds()*p.rate
+}
+
+// apply updates the state with a playback control message.
+// The message should have been validated by kecpmsg.Parse.
+func (p *playback) apply(message *kecpmsg.Message, now time.Time) {
+	switch message.Type {
+	case kecpmsg.Play:
+		p.position = message.Payload.(float64)
+		p.paused = false
+	case kecpmsg.Pause:
+		p.position = message.Payload.(float64)
+		p.paused = true
+	case kecpmsg.Seek:
+		p.position = message.Payload.(float64)
+	case kecpmsg.RateChange:
+		p.position = p.positionAt(now)
+		p.rate = message.Payload.(float64)
+	default:
+		return
+	}
+	p.updatedAt = now
+}
+
+// sync takes the state broadcast by another node.
+func (p *playback) sync(state kecpmsg.PlaybackState) {
+	p.position = state.Position
+	p.paused = state.Paused
+	p.rate = state.Rate
+	p.updatedAt = time.UnixMilli(state.ServerTime)
+}
+
+func (p *playback) state(now time.Time) kecpmsg.PlaybackState {
+	return kecpmsg.PlaybackState{
+		Position:   p.positionAt(now),
+		Paused:     p.paused,
+		Rate:       p.rate,
+		ServerTime: now.UnixMilli(),
+	}
+}
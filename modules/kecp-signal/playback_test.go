@@ -0,0 +1,43 @@
+package kecpsignal_test
+
+import (
+	"testing"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlaybackSync(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	roomID := reg.NewRoom(newKey())
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: newKey()})
+	assert.Equal(t, kecpmsg.List, readMsg(t, alice).Type)
+	state := readMsg(t, alice)
+	assert.Equal(t, kecpmsg.Playback, state.Type)
+	assert.Equal(t, true, state.Payload.(map[string]interface{})["paused"])
+
+	for _, control := range []*kecpmsg.Message{
+		{Type: kecpmsg.Seek, Name: "Alice", Payload: 30.0},
+		{Type: kecpmsg.RateChange, Name: "Alice", Payload: 2.0},
+		{Type: kecpmsg.Play, Name: "Alice", Payload: 42.0},
+	} {
+		writeMsg(t, alice, control)
+		state = readMsgOfType(t, alice, kecpmsg.Playback)
+		assert.Equal(t, "Alice", state.Name)
+	}
+	assert.Equal(t, false, state.Payload.(map[string]interface{})["paused"])
+
+	// The late joiner gets the state right after the list.
+	bob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: newKey()})
+	assert.Equal(t, kecpmsg.List, readMsg(t, bob).Type)
+	state = readMsg(t, bob)
+	assert.Equal(t, kecpmsg.Playback, state.Type)
+	payload := state.Payload.(map[string]interface{})
+	assert.Equal(t, false, payload["paused"])
+	assert.Equal(t, 2.0, payload["rate"])
+	assert.GreaterOrEqual(t, payload["position"], 42.0)
+	assert.NotZero(t, payload["server_time"])
+}
@@ -0,0 +1,57 @@
+package kecpsignal_test
+
+import (
+	"testing"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	kecpsfu "github.com/fourdim/kecp/modules/kecp-sfu"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelay(t *testing.T) {
+	reg := NewRegistry(WithRelayConfig(kecpsfu.Config{}))
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey, WithRelay(true))
+
+	info, err := reg.RoomInfo(roomID, mgtKey)
+	assert.NoError(t, err)
+	assert.True(t, info.Relay)
+
+	relay := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: kecpmsg.RelayName, ClientKey: newKey()})
+	assert.Equal(t, ErrNameIsAlreadyInUse.Error(), readMsg(t, relay).Payload)
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: newKey()})
+	assert.Equal(t, kecpmsg.List, readMsg(t, alice).Type)
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	defer pc.Close()
+	_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendonly})
+	assert.NoError(t, err)
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pc.SetLocalDescription(offer))
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.VideoOffer, Name: "Alice", Target: kecpmsg.RelayName, Payload: offer})
+
+	answer := readMsgOfType(t, alice, kecpmsg.VideoAnswer)
+	assert.Equal(t, kecpmsg.RelayName, answer.Name)
+	assert.Equal(t, "answer", answer.Payload.(map[string]any)["type"])
+
+	// The candidates of the relay follow its answer.
+	candidate := readMsgOfType(t, alice, kecpmsg.NewIceCandidate)
+	assert.Equal(t, kecpmsg.RelayName, candidate.Name)
+	assert.Contains(t, candidate.Payload.(map[string]any)["candidate"], "candidate:")
+}
+
+func TestRelayNotAllowed(t *testing.T) {
+	reg := NewRegistry()
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey, WithRelay(true))
+
+	info, err := reg.RoomInfo(roomID, mgtKey)
+	assert.NoError(t, err)
+	assert.False(t, info.Relay)
+}
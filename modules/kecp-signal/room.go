@@ -1,11 +1,15 @@
 package kecpsignal
 
 import (
+	"bytes"
+	"crypto/subtle"
 	"time"
 
+	kecpbroker "github.com/fourdim/kecp/modules/kecp-broker"
 	kchan "github.com/fourdim/kecp/modules/kecp-channel"
 	kecpcrypto "github.com/fourdim/kecp/modules/kecp-crypto"
 	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	kecpsfu "github.com/fourdim/kecp/modules/kecp-sfu"
 	kecpvalidate "github.com/fourdim/kecp/modules/kecp-validate"
 )
 
@@ -16,57 +20,330 @@ const (
 type Room struct {
 	RoomID string
 
-	// Creator's key
-	MgtKey string
+	// The hash of the creator's key.
+	// Should be readonly.
+	mgtKeyHash []byte
+
+	CreatedAt time.Time
+
+	// Whether new clients are refused.
+	// Only the run goroutine can access it.
+	locked bool
+
+	// The maximum member count, 0 for unlimited.
+	// Only the run goroutine can access it.
+	maxMembers int
+
+	// Whether the clients need an invite to join.
+	// Only the run goroutine can access it.
+	inviteOnly bool
+
+	// The hashes of the client keys which joined with each invite.
+	// Only the run goroutine can access it.
+	inviteUses map[string]map[string]bool
+
+	// The salted hash of the passphrase, nil if there is none.
+	// Should be readonly.
+	passphraseSalt []byte
+	passphraseHash []byte
 
 	// Registry
 	registry *Registry
 
+	// Whether the room was created on another node.
+	// Should be readonly.
+	replica bool
+
+	// Whether the room counts against the room cap of the registry,
+	// as the rooms created by NewRoom do.
+	// Should be readonly.
+	capped bool
+
+	// Members whose clients are on other nodes, by name.
+	// Only the run goroutine can access it.
+	remoteMembers map[string]*remoteMember
+
+	// Events of the other nodes from the broker.
+	remote chan *kecpbroker.Event
+
+	// Stops the events from the broker, nil if the subscription failed.
+	unsubscribe func()
+
+	// Events for the other nodes, published in order by the outbox
+	// goroutine, so that the run goroutine never waits for the broker.
+	// Nil if there is no broker.
+	outbox chan *kecpbroker.Event
+
 	// Registered clients.
 	clients map[string]*Client
 
+	// Clients whose connection was lost, waiting for a resumption.
+	sessions sessions
+
+	// Clients waiting for a place in the full room.
+	// Only the run goroutine can access it.
+	lobby lobby
+
+	// The shape of the peer connections planned for the members.
+	// Only the run goroutine can access it.
+	topology kecpmsg.Topology
+
+	// The sequence number of the last join. The sequence numbers are
+	// taken from the clock, so that they order the joins on every node.
+	// Only the run goroutine can access it.
+	joinSeq uint64
+
+	// Whether the room asked for a relay on creation.
+	relayRequested bool
+
+	// The relay forwarding the tracks, nil if there is none.
+	// Should be readonly.
+	relay *kecpsfu.Relay
+
+	// Messages from the relay to the clients, in order.
+	relayed chan *kecpmsg.Message
+
 	// Inbound messages from the clients.
 	broadcast *kchan.Channel[*kecpmsg.Message]
 
 	// Inbound messages from the clients.
 	forward *kchan.Channel[*kecpmsg.Message]
 
+	// Inbound playback control messages from the clients.
+	playbackControl *kchan.Channel[*kecpmsg.Message]
+
+	// The playback state shared by the clients.
+	playback *playback
+
+	// The member who last played the media, the root of a relay tree.
+	streamer string
+
+	// Inbound moderator commands from the clients.
+	moderation *kchan.Channel[*moderation]
+
+	// Who is banned or muted.
+	// Only the run goroutine can access it.
+	sanctions sanctions
+
 	// Register requests from the clients.
 	register *kchan.Channel[*Client]
 
 	// Unregister requests from clients.
 	unregister *kchan.Channel[*Client]
 
+	// Info queries from the registry.
+	infoQuery *kchan.Channel[chan *RoomInfo]
+
+	// Settings updates from the registry.
+	settingsUpdate *kchan.Channel[*settingsUpdate]
+
+	// Membership queries from the registry.
+	memberQuery *kchan.Channel[*memberQuery]
+
+	// Details queries from the registry.
+	detailsQuery *kchan.Channel[chan *RoomDetails]
+
+	// Disconnection requests from the registry.
+	disconnection *kchan.Channel[*disconnection]
+
+	// The rate of the messages from the members.
+	// Only the run goroutine can access it.
+	messageRate rateMeter
+
 	// The status returned after register.
 	created chan bool
 
 	// Channel for self destruction.
 	selfDestruction chan bool
+
+	// Closed by the registry when the server is shutting down.
+	stopping chan struct{}
+
+	// How to close the clients on shutdown.
+	// Written by the registry before closing stopping.
+	shutdown *shutdown
+
+	// Whether the room stopped for a shutdown, rather than being deleted.
+	// Only the run goroutine can access it.
+	stopped bool
+
+	// Closed when the run goroutine exits.
+	done chan struct{}
 }
 
-func (reg *Registry) NewRoom(managementKey string) string {
-	if !kecpvalidate.IsAValidCryptoKey(managementKey) {
-		return ""
+// RoomInfo is a snapshot of a room.
+type RoomInfo struct {
+	RoomID     string
+	Members    int
+	Waiting    int
+	MaxMembers int
+	CreatedAt  time.Time
+	Locked     bool
+	InviteOnly bool
+	Protected  bool
+	Relay      bool
+	Topology   kecpmsg.Topology
+}
+
+// RoomSettings holds the room settings to change.
+// Nil fields are left untouched.
+type RoomSettings struct {
+	Locked     *bool
+	MaxMembers *int
+	InviteOnly *bool
+	Topology   *kecpmsg.Topology
+}
+
+// RoomOption configures a room on creation.
+type RoomOption func(room *Room)
+
+// WithMaxMembers limits the member count of the room, 0 or less for unlimited,
+// within the MaxMembers of the registry's limits.
+// The clients joining the full room wait in the lobby.
+func WithMaxMembers(maxMembers int) RoomOption {
+	return func(room *Room) {
+		room.maxMembers = maxMembers
+	}
+}
+
+// WithInviteOnly requires the clients to present an invite on auth.
+func WithInviteOnly(inviteOnly bool) RoomOption {
+	return func(room *Room) {
+		room.inviteOnly = inviteOnly
+	}
+}
+
+// WithTopology sets the shape of the peer connections, mesh by default.
+func WithTopology(topology kecpmsg.Topology) RoomOption {
+	return func(room *Room) {
+		if topology.IsValid() {
+			room.topology = topology
+		}
 	}
-	roomID := kecpcrypto.GenerateRoomID()
+}
+
+// WithRelay lets the clients offer their tracks to the relay, which
+// forwards them to the other members, if the registry allows relays.
+func WithRelay(relay bool) RoomOption {
+	return func(room *Room) {
+		room.relayRequested = relay
+	}
+}
+
+// WithPassphrase requires the clients to present the passphrase on auth.
+// Only a salted hash of the passphrase is kept.
+func WithPassphrase(passphrase string) RoomOption {
+	return func(room *Room) {
+		if passphrase == "" {
+			return
+		}
+		room.passphraseSalt = kecpcrypto.GenerateSalt()
+		room.passphraseHash = kecpcrypto.HashPassphrase(passphrase, room.passphraseSalt)
+	}
+}
+
+type settingsUpdate struct {
+	settings RoomSettings
+	info     chan *RoomInfo
+}
+
+type memberQuery struct {
+	clientKey string
+	isMember  chan bool
+}
+
+func newRoom(reg *Registry, roomID string) *Room {
 	room := &Room{
 		RoomID:          roomID,
-		MgtKey:          managementKey,
+		CreatedAt:       time.Now(),
+		topology:        kecpmsg.Mesh,
 		registry:        reg,
+		remoteMembers:   make(map[string]*remoteMember),
+		remote:          make(chan *kecpbroker.Event),
 		broadcast:       kchan.New[*kecpmsg.Message](),
 		forward:         kchan.New[*kecpmsg.Message](),
+		playbackControl: kchan.New[*kecpmsg.Message](),
+		playback:        newPlayback(time.Now()),
+		moderation:      kchan.New[*moderation](),
+		sanctions:       newSanctions(),
+		inviteUses:      make(map[string]map[string]bool),
 		register:        kchan.New[*Client](),
 		unregister:      kchan.New[*Client](),
+		infoQuery:       kchan.New[chan *RoomInfo](),
+		settingsUpdate:  kchan.New[*settingsUpdate](),
+		memberQuery:     kchan.New[*memberQuery](),
+		detailsQuery:    kchan.New[chan *RoomDetails](),
+		disconnection:   kchan.New[*disconnection](),
+		messageRate:     rateMeter{start: time.Now()},
+		relayed:         make(chan *kecpmsg.Message),
 		clients:         make(map[string]*Client),
+		sessions:        newSessions(),
 		created:         make(chan bool),
 		selfDestruction: make(chan bool),
+		stopping:        make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+	if reg.broker != nil {
+		room.outbox = make(chan *kecpbroker.Event, outboxSize)
+	}
+	return room
+}
+
+func (reg *Registry) NewRoom(managementKey string, options ...RoomOption) string {
+	if !kecpvalidate.IsAValidCryptoKey(managementKey) || reg.IsDraining() {
+		return ""
 	}
+	room := newRoom(reg, kecpcrypto.GenerateRoomID())
+	room.mgtKeyHash = hashKey(managementKey)
+	for _, option := range options {
+		option(room)
+	}
+	room.maxMembers = reg.Limits().capMembers(room.maxMembers)
+	room.capped = true
+	if room.relayRequested && reg.relayConfig != nil {
+		room.relay = kecpsfu.New(*reg.relayConfig, room.relayMessage)
+	}
+	putRecord(reg, room.record())
+	saveRoom(room)
+	if !room.start() {
+		// The registry is shutting down, or has too many rooms.
+		if room.relay != nil {
+			room.relay.Close()
+		}
+		deleteRecord(reg, room.RoomID)
+		forgetRoom(room)
+		return ""
+	}
+	roomsCreated.Inc()
+	reg.log().Info("room created", "room", room.RoomID, "relay", room.relay != nil)
+	notify(room, RoomCreated, "", "")
+	return room.RoomID
+}
+
+// start registers the room, subscribes to the events of the other nodes
+// and runs the room. It reports false if the registry has a room with the ID,
+// or too many rooms, or is shutting down.
+func (room *Room) start() bool {
 	room.registry.register.Write(room)
 	select {
-	case <-room.created:
+	case created := <-room.created:
+		if !created {
+			return false
+		}
+	case <-room.registry.done:
+		return false
+	}
+	if reg := room.registry; reg.broker != nil {
+		unsubscribe, err := reg.broker.Subscribe(room.RoomID, room.receive)
+		if err != nil {
+			reg.log().Error("cannot subscribe to the room", "room", room.RoomID, "error", err)
+		}
+		room.unsubscribe = unsubscribe
+		reg.outboxes.Add(1)
+		go room.publishOutbox()
 	}
 	go room.run()
-	return roomID
+	return true
 }
 
 func (room *Room) run() {
@@ -75,102 +352,430 @@ func (room *Room) run() {
 	checker := time.NewTimer(roomLiveCheckWait)
 	defer func() {
 		checker.Stop()
+		if room.relay != nil {
+			room.relay.Close()
+		}
+		if room.unsubscribe != nil {
+			room.unsubscribe()
+		}
+		if room.outbox != nil {
+			close(room.outbox)
+		}
+		// The room outlives a shutdown.
+		if !room.replica && !room.stopped {
+			deleteRecord(room.registry, room.RoomID)
+			forgetRoom(room)
+			roomsDeleted.Inc()
+			room.registry.log().Info("room deleted", "room", room.RoomID)
+			notify(room, RoomDeleted, "", "")
+		}
+		close(room.done)
 		room.registry.unregister.Write(room)
 	}()
+	// The other nodes tell the members they have.
+	publish(room, &kecpbroker.Event{Type: kecpbroker.Sync})
 	for {
 		select {
 		case client := <-room.register.Read():
+			if room.isBanned(client) {
+				client.joined <- ErrBannedFromTheRoom
+				break
+			}
+			if resume(room, client) {
+				break
+			}
+			if _, ok := room.clients[client.clientKey]; room.locked && !ok && !room.isManager(client.clientKey) {
+				client.joined <- ErrRoomIsLocked
+				break
+			}
+			if _, ok := room.clients[client.clientKey]; room.inviteOnly && client.invite == nil && !ok && !room.isManager(client.clientKey) {
+				client.joined <- ErrInviteRequired
+				break
+			}
 			var joined = true
-			for _, eachClient := range room.clients {
+			for _, eachClient := range append(room.members(), room.lobby.waiting...) {
 				// Same name, but not the same client.
 				if client.name == eachClient.name && client.clientKey != eachClient.clientKey {
 					joined = false
 					break
 				}
 			}
+			if member, ok := room.remoteMembers[client.name]; ok && !bytes.Equal(member.keyHash, hashKey(client.clientKey)) {
+				joined = false
+			}
+			if client.name == kecpmsg.RelayName {
+				joined = false
+			}
 			if !joined {
-				client.joined <- false
+				client.joined <- ErrNameIsAlreadyInUse
+				break
+			}
+			if replaceInLobby(room, client) {
+				client.joined <- nil
+				break
+			}
+			if err := checkInvite(room, client); err != nil {
+				client.joined <- err
+				break
+			}
+			if _, ok := room.clients[client.clientKey]; !ok && room.sessions.away[client.clientKey] == nil && room.isFull() && !room.isManager(client.clientKey) {
+				client.joined <- nil
+				enqueue(room, client)
 				break
 			}
 			if previousClient, ok := room.clients[client.clientKey]; ok {
-				previousClient.selfDestruction <- true
+				room.registry.log().Info("client replaced", clientAttrs(previousClient)...)
+				selfDestruct(previousClient)
+				previousClient.left = true
 				broadcast(room, kecpmsg.NewLeaveMsg(previousClient.name, previousClient.clientKey))
 			}
-			room.clients[client.clientKey] = client
-			client.joined <- true
-			var names []string
-			for _, eachClient := range room.clients {
-				names = append(names, eachClient.name)
+			if awayClient, ok := room.sessions.away[client.clientKey]; ok {
+				dismissAway(room, awayClient)
 			}
-			client.send <- kecpmsg.NewListMsg(names)
-			broadcast(room, kecpmsg.NewJoinMsg(client.name, client.clientKey))
+			client.joined <- nil
+			join(room, client)
 		case clientUnregistered := <-room.unregister.Read():
-			var replace bool
-			if client, ok := room.clients[clientUnregistered.clientKey]; ok {
-				if client == clientUnregistered {
-					replace = false
-					delete(room.clients, clientUnregistered.clientKey)
-				} else {
-					replace = true
-				}
+			if removeFromLobby(room, clientUnregistered) {
+				clientUnregistered.left = true
+				closeClient(clientUnregistered)
+				break
+			}
+			if room.clients[clientUnregistered.clientKey] == clientUnregistered && clientUnregistered.lost && !clientUnregistered.closed {
+				setAway(room, clientUnregistered)
+				break
+			}
+			if client, ok := room.clients[clientUnregistered.clientKey]; ok && client == clientUnregistered {
+				delete(room.clients, clientUnregistered.clientKey)
 			}
-			close(clientUnregistered.send)
-			close(clientUnregistered.joined)
-			close(clientUnregistered.selfDestruction)
-			if !replace {
+			closeClient(clientUnregistered)
+			if !clientUnregistered.left {
+				room.registry.log().Info("client left", clientAttrs(clientUnregistered)...)
+				clientUnregistered.left = true
 				broadcast(room, kecpmsg.NewLeaveMsg(clientUnregistered.name, clientUnregistered.clientKey))
+				replan(room)
 			}
-			if len(room.clients) == 0 {
+			admitFromLobby(room)
+			if room.isEmpty() {
+				return
+			}
+		case client := <-room.sessions.expired.Read():
+			dismissAway(room, client)
+			admitFromLobby(room)
+			if room.isEmpty() {
+				return
+			}
+		case moderation := <-room.moderation.Read():
+			moderate(room, moderation)
+			admitFromLobby(room)
+			if room.isEmpty() {
 				return
 			}
 		case message := <-room.forward.Read():
+			if !isFromMember(room, message) || isMutedChat(room, message) {
+				break
+			}
+			room.messageRate.add(time.Now())
+			if message.Target == kecpmsg.RelayName && room.relay != nil {
+				writeToRelay(room, message)
+			} else {
+				forward(room, message)
+			}
+			if room.isEmpty() {
+				return
+			}
+		case message := <-room.relayed:
 			forward(room, message)
-			if len(room.clients) == 0 {
+		case event := <-room.remote:
+			if handleEvent(room, event) {
+				return
+			}
+			if room.isEmpty() {
 				return
 			}
 		case message := <-room.broadcast.Read():
+			if !isFromMember(room, message) || isMutedChat(room, message) {
+				break
+			}
+			room.messageRate.add(time.Now())
 			broadcast(room, message)
-			if len(room.clients) == 0 {
+			if room.isEmpty() {
+				return
+			}
+		case message := <-room.playbackControl.Read():
+			if !isFromMember(room, message) {
+				break
+			}
+			now := time.Now()
+			room.messageRate.add(now)
+			room.playback.apply(message, now)
+			broadcast(room, kecpmsg.NewPlaybackMsg(message.Name, room.playback.state(now)))
+			followStreamer(room, message.Name)
+			if room.isEmpty() {
 				return
 			}
 		// Delete the room if no one joins.
 		case <-checker.C:
-			if len(room.clients) == 0 {
+			if room.isEmpty() {
 				return
 			}
+		case reply := <-room.infoQuery.Read():
+			reply <- room.info()
+		case update := <-room.settingsUpdate.Read():
+			if update.settings.Locked != nil {
+				room.locked = *update.settings.Locked
+			}
+			if update.settings.InviteOnly != nil {
+				room.inviteOnly = *update.settings.InviteOnly
+			}
+			if update.settings.MaxMembers != nil {
+				room.maxMembers = room.registry.Limits().capMembers(*update.settings.MaxMembers)
+				admitFromLobby(room)
+			}
+			if update.settings.Topology != nil {
+				room.topology = *update.settings.Topology
+				replan(room)
+			}
+			record := room.record()
+			putRecord(room.registry, record)
+			saveRoom(room)
+			publish(room, &kecpbroker.Event{Type: kecpbroker.Update, Record: record})
+			update.info <- room.info()
+		case query := <-room.memberQuery.Read():
+			_, joined := room.clients[query.clientKey]
+			_, away := room.sessions.away[query.clientKey]
+			query.isMember <- joined || away || isRemoteMember(room, query.clientKey)
+		case reply := <-room.detailsQuery.Read():
+			reply <- room.details()
+		case disconnection := <-room.disconnection.Read():
+			disconnection.err <- disconnect(room, disconnection.name)
+			admitFromLobby(room)
+			if room.isEmpty() {
+				return
+			}
+		case <-room.stopping:
+			closeForShutdown(room)
+			return
 		case <-room.selfDestruction:
-			for _, client := range room.clients {
-				client.selfDestruction <- true
+			publish(room, &kecpbroker.Event{Type: kecpbroker.Delete})
+			for _, client := range append(room.members(), room.lobby.waiting...) {
+				selfDestruct(client)
 			}
+			return
 		}
 	}
 }
 
+// isManager reports whether the key is the creator's key.
+func (room *Room) isManager(key string) bool {
+	return subtle.ConstantTimeCompare(hashKey(key), room.mgtKeyHash) == 1
+}
+
+// members returns both the registered and the away clients.
+func (room *Room) members() []*Client {
+	members := make([]*Client, 0, len(room.clients)+len(room.sessions.away))
+	for _, client := range room.clients {
+		members = append(members, client)
+	}
+	for _, client := range room.sessions.away {
+		members = append(members, client)
+	}
+	return members
+}
+
+func (room *Room) isEmpty() bool {
+	return len(room.clients) == 0 && len(room.sessions.away) == 0 && len(room.remoteMembers) == 0
+}
+
+func (room *Room) info() *RoomInfo {
+	return &RoomInfo{
+		RoomID:     room.RoomID,
+		Members:    len(room.clients) + len(room.remoteMembers),
+		Waiting:    len(room.lobby.waiting),
+		MaxMembers: room.maxMembers,
+		CreatedAt:  room.CreatedAt,
+		Locked:     room.locked,
+		InviteOnly: room.inviteOnly,
+		Relay:      room.relay != nil,
+		Topology:   room.topology,
+		Protected:  room.passphraseHash != nil,
+	}
+}
+
+// verifyPassphrase reports whether the passphrase lets a client in.
+func (room *Room) verifyPassphrase(passphrase string) bool {
+	if room.passphraseHash == nil {
+		return true
+	}
+	return kecpcrypto.VerifyPassphrase(passphrase, room.passphraseSalt, room.passphraseHash)
+}
+
+// join lets the client in and tells the others.
+func join(room *Room, client *Client) {
+	if _, ok := room.remoteMembers[client.name]; ok {
+		// The client came back from another node.
+		delete(room.remoteMembers, client.name)
+		broadcastLocally(room, kecpmsg.NewLeaveMsg(client.name, client.clientKey))
+	}
+	room.clients[client.clientKey] = client
+	room.joinSeq++
+	if now := uint64(time.Now().UnixNano()); now > room.joinSeq {
+		room.joinSeq = now
+	}
+	client.joinSeq = room.joinSeq
+	client.joinedAt = time.Now()
+	useInvite(room, client)
+	client.resumeToken = kecpcrypto.GenerateCryptoKey()
+	sendRoomState(room, client)
+	sendToSingleClient(room, client, kecpmsg.NewSessionMsg(client.resumeToken, false))
+	room.registry.log().Info("client joined", clientAttrs(client)...)
+	broadcast(room, kecpmsg.NewJoinMsg(client.name, client.clientKey))
+	replan(room)
+}
+
+// sendRoomState tells the client who is in the room and where the playback is.
+func sendRoomState(room *Room, client *Client) {
+	var names []string
+	for _, eachClient := range room.members() {
+		names = append(names, eachClient.name)
+	}
+	for name := range room.remoteMembers {
+		names = append(names, name)
+	}
+	sendToSingleClient(room, client, kecpmsg.NewListMsg(names))
+	sendToSingleClient(room, client, kecpmsg.NewPlaybackMsg("", room.playback.state(time.Now())))
+}
+
+// isFromMember reports whether the sender of the message is in the room,
+// rather than waiting in the lobby.
+func isFromMember(room *Room, message *kecpmsg.Message) bool {
+	return findClientByName(room, message.Name) != nil
+}
+
+// broadcast sends the message to the members on every node.
 func broadcast(room *Room, message *kecpmsg.Message) {
-	for clientKey, client := range room.clients {
-		if message.ExceptClientKey == clientKey {
+	// The payload of a join or leave message is the name.
+	switch name, _ := message.Payload.(string); message.Type {
+	case kecpmsg.Join:
+		joins.Inc()
+		notify(room, ClientJoined, name, message.ExceptClientKey)
+	case kecpmsg.Leave:
+		leaves.Inc()
+		notify(room, ClientLeft, name, message.ExceptClientKey)
+	}
+	start := time.Now()
+	broadcastLocally(room, message)
+	publishMessage(room, message)
+	fanOutDuration.WithLabelValues(string(message.Type)).Observe(time.Since(start).Seconds())
+}
+
+func broadcastLocally(room *Room, message *kecpmsg.Message) {
+	if message.Type == kecpmsg.Join || message.Type == kecpmsg.Leave {
+		// The relay keeps track of the members as well.
+		writeToRelay(room, message)
+	}
+	for _, client := range room.members() {
+		if message.ExceptClientKey == client.clientKey {
 			continue
 		}
 		sendToSingleClient(room, client, message)
 	}
 }
 
+// forward sends the message to its target, on whichever node it is.
 func forward(room *Room, message *kecpmsg.Message) {
-	for _, client := range room.clients {
+	if forwardLocally(room, message) {
+		return
+	}
+	if _, ok := room.remoteMembers[message.Target]; ok || message.Target == kecpmsg.RelayName {
+		publish(room, &kecpbroker.Event{Type: kecpbroker.Forward, Message: message})
+	}
+}
+
+func forwardLocally(room *Room, message *kecpmsg.Message) bool {
+	for _, client := range room.members() {
 		if message.Target == client.name {
 			sendToSingleClient(room, client, message)
-			break
+			return true
 		}
 	}
+	return false
+}
+
+// relayMessage hands a message of the relay over to the run goroutine.
+func (room *Room) relayMessage(message *kecpmsg.Message) {
+	select {
+	case room.relayed <- message:
+	case <-room.done:
+	}
+}
+
+// writeToRelay hands the message over to the relay, if the room has one.
+func writeToRelay(room *Room, message *kecpmsg.Message) {
+	if room.relay == nil {
+		return
+	}
+	if err := room.relay.Write(message); err != nil {
+		room.registry.log().Warn("message to the relay dropped", "room", room.RoomID, "type", message.Type, "name", message.Name, "error", err)
+	}
 }
 
 func sendToSingleClient(room *Room, client *Client, message *kecpmsg.Message) {
+	if client.closed {
+		return
+	}
 	select {
 	case client.send <- message:
 	default:
+		if room.sessions.isAway(client) {
+			// Kept for a resumption, which tells the client to start over.
+			if !client.overflowed {
+				room.registry.log().Warn("messages for the away client dropped", clientAttrs(client)...)
+			}
+			client.overflowed = true
+			break
+		}
+		slowConsumerDrops.Inc()
+		room.registry.log().Warn("slow client dropped", clientAttrs(client)...)
 		delete(room.clients, client.clientKey)
-		close(client.send)
-		close(client.joined)
-		close(client.selfDestruction)
+		closeClient(client)
+	}
+}
+
+// closeClient closes the client's send channel. The writePump flushes
+// the queued messages and then closes the connection, so that the
+// readPump unregisters the client.
+func closeClient(client *Client) {
+	if client.closed {
+		return
+	}
+	client.closed = true
+	close(client.send)
+}
+
+// selfDestruct makes the writePump of the client return at once. The
+// readPump then unregisters the client.
+func selfDestruct(client *Client) {
+	select {
+	case client.selfDestruction <- true:
+	default:
+	}
+}
+
+// findMemberByName finds the registered or away client.
+func findMemberByName(room *Room, name string) *Client {
+	for _, client := range room.members() {
+		if client.name == name {
+			return client
+		}
+	}
+	return nil
+}
+
+func findClientByName(room *Room, name string) *Client {
+	for _, client := range room.clients {
+		if client.name == name {
+			return client
+		}
 	}
+	return nil
 }
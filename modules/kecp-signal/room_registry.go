@@ -1,6 +1,16 @@
 package kecpsignal
 
-import kchan "github.com/fourdim/kecp/modules/kecp-channel"
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	kecpbroker "github.com/fourdim/kecp/modules/kecp-broker"
+	kchan "github.com/fourdim/kecp/modules/kecp-channel"
+	kecpcrypto "github.com/fourdim/kecp/modules/kecp-crypto"
+	kecpsfu "github.com/fourdim/kecp/modules/kecp-sfu"
+	kecpstore "github.com/fourdim/kecp/modules/kecp-store"
+)
 
 type Registry struct {
 	rooms map[string]*Room
@@ -14,39 +24,173 @@ type Registry struct {
 	// roomQuery is written by the clients
 	roomQuery *kchan.Channel[*roomQuery]
 
+	// roomsQuery is written by the operators
+	roomsQuery *kchan.Channel[chan []*Room]
+
 	// roomDeletionRequest
 	roomDeletionRequest chan *roomDeletion
+
+	// The events for the operators.
+	events feed
+
+	// The secret signing the invite tokens.
+	// Should be readonly.
+	inviteSecret []byte
+
+	// The configuration of the relays, nil if the rooms cannot have one.
+	// Should be readonly.
+	relayConfig *kecpsfu.Config
+
+	// The broker carrying the events of the rooms between the nodes,
+	// nil if the rooms are only known to this registry.
+	// Should be readonly.
+	broker kecpbroker.Broker
+
+	// The ID of this node in the events.
+	// Should be readonly.
+	node string
+
+	// The store keeping the rooms across restarts, nil if there is none.
+	// Should be readonly.
+	store kecpstore.Store
+
+	// The logger of the events, nil for the default one.
+	// Should be readonly.
+	logger LeveledLogger
+
+	// The goroutines publishing the outboxes of the rooms.
+	outboxes sync.WaitGroup
+
+	// Shutdown requests, only the first one is sent.
+	shutdownRequest chan *shutdown
+	shutdownOnce    sync.Once
+
+	// The pumps of the clients, counted until the registry is closed.
+	pumps   sync.WaitGroup
+	pumpsMu sync.Mutex
+	closed  bool
+
+	// Closed when the registry starts shutting down.
+	draining chan struct{}
+
+	// The slots of the passphrase verifications running at once.
+	verifications chan struct{}
+
+	// The recent incorrect passphrases of each address.
+	passphraseFailures *failureLimiter
+
+	// The limits of the rooms and the clients, set at any time.
+	limits atomic.Pointer[Limits]
+
+	// Closed when the run goroutine exits.
+	done chan struct{}
+}
+
+// RegistryOption configures a registry on creation.
+type RegistryOption func(reg *Registry)
+
+// WithInviteSecret sets the secret signing the invite tokens.
+// Without it, a random secret is used, and the invite tokens
+// become invalid when the registry is gone.
+func WithInviteSecret(secret []byte) RegistryOption {
+	return func(reg *Registry) {
+		if len(secret) > 0 {
+			reg.inviteSecret = secret
+		}
+	}
+}
+
+// WithRelayConfig lets the rooms created with WithRelay have a relay.
+func WithRelayConfig(config kecpsfu.Config) RegistryOption {
+	return func(reg *Registry) {
+		reg.relayConfig = &config
+	}
 }
 
-func NewRegistry() *Registry {
+// WithBroker shares the rooms with the other nodes using the broker.
+// Without it, the rooms are only known to this registry.
+// The broker should be closed after the registry.
+func WithBroker(broker kecpbroker.Broker) RegistryOption {
+	return func(reg *Registry) {
+		reg.broker = broker
+	}
+}
+
+func NewRegistry(options ...RegistryOption) *Registry {
 	reg := &Registry{
 		rooms:               make(map[string]*Room),
 		register:            kchan.New[*Room](),
 		unregister:          kchan.New[*Room](),
 		roomQuery:           kchan.New[*roomQuery](),
+		roomsQuery:          kchan.New[chan []*Room](),
 		roomDeletionRequest: make(chan *roomDeletion),
+		inviteSecret:        kecpcrypto.GenerateSecret(),
+		node:                kecpcrypto.GenerateRoomID(),
+		shutdownRequest:     make(chan *shutdown),
+		draining:            make(chan struct{}),
+		verifications:       make(chan struct{}, maxConcurrentVerifications),
+		passphraseFailures:  newFailureLimiter(maxPassphraseFailuresPerAddr, passphraseFailureWindow),
+		done:                make(chan struct{}),
+	}
+	reg.limits.Store(&Limits{})
+	for _, option := range options {
+		option(reg)
 	}
 	go reg.run()
+	if reg.store != nil {
+		reg.restore()
+	}
 	return reg
 }
 
 func (reg *Registry) run() {
 	// Only this goroutine can access
 	// Registry.rooms
+	defer func() {
+		// The pending writes are dropped.
+		reg.register.Close()
+		reg.unregister.Close()
+		reg.roomQuery.Close()
+		reg.roomsQuery.Close()
+		close(reg.done)
+	}()
 	for {
 		select {
 		case room := <-reg.register.Read():
+			if _, ok := reg.rooms[room.RoomID]; ok || reg.IsDraining() {
+				room.created <- false
+				break
+			}
+			if room.capped && reg.isOverRoomCap() {
+				reg.log().Warn("room not created, too many rooms", "room", room.RoomID)
+				room.created <- false
+				break
+			}
 			reg.rooms[room.RoomID] = room
+			roomsGauge.Inc()
 			room.created <- true
 		case room := <-reg.unregister.Read():
 			if _, ok := reg.rooms[room.RoomID]; ok {
 				delete(reg.rooms, room.RoomID)
+				roomsGauge.Dec()
 				room.broadcast.Close()
+				room.forward.Close()
+				room.playbackControl.Close()
+				room.moderation.Close()
 				room.register.Close()
 				room.unregister.Close()
+				room.sessions.expired.Close()
+				room.infoQuery.Close()
+				room.settingsUpdate.Close()
+				room.memberQuery.Close()
+				room.detailsQuery.Close()
+				room.disconnection.Close()
 				close(room.created)
 				close(room.selfDestruction)
 			}
+			if reg.IsDraining() && len(reg.rooms) == 0 {
+				return
+			}
 		case roomQuery := <-reg.roomQuery.Read():
 			if room, ok := reg.rooms[roomQuery.roomID]; ok {
 				roomQuery.room <- room
@@ -54,9 +198,34 @@ func (reg *Registry) run() {
 				roomQuery.room <- nil
 			}
 			close(roomQuery.room)
+		case reply := <-reg.roomsQuery.Read():
+			rooms := make([]*Room, 0, len(reg.rooms))
+			for _, room := range reg.rooms {
+				rooms = append(rooms, room)
+			}
+			reply <- rooms
 		case roomDele := <-reg.roomDeletionRequest:
-			if room, ok := reg.rooms[roomDele.roomID]; ok && room.MgtKey == roomDele.mgtKey {
-				room.selfDestruction <- true
+			room, ok := reg.rooms[roomDele.roomID]
+			if !ok {
+				roomDele.err <- ErrRoomNotFound
+				break
+			}
+			if !roomDele.force && !room.isManager(roomDele.mgtKey) {
+				roomDele.err <- ErrWrongManagementKey
+				break
+			}
+			select {
+			case room.selfDestruction <- true:
+			case <-room.done:
+			}
+			roomDele.err <- nil
+		case request := <-reg.shutdownRequest:
+			close(reg.draining)
+			for _, room := range reg.rooms {
+				room.stop(request)
+			}
+			if len(reg.rooms) == 0 {
+				return
 			}
 		}
 	}
@@ -67,21 +236,147 @@ type roomQuery struct {
 	room   chan *Room
 }
 
+// GetRoom returns the room, replicating it if it was created on another node,
+// or nil if there is no such room.
 func (reg *Registry) GetRoom(roomID string) *Room {
+	if reg.IsDraining() {
+		return nil
+	}
+	if room := reg.getLocalRoom(roomID); room != nil {
+		return room
+	}
+	return reg.replicate(roomID)
+}
+
+func (reg *Registry) getLocalRoom(roomID string) *Room {
 	roomQuery := &roomQuery{
 		roomID: roomID,
 		room:   make(chan *Room),
 	}
 	reg.roomQuery.Write(roomQuery)
-	room := <-roomQuery.room
-	return room
+	select {
+	case room := <-roomQuery.room:
+		return room
+	case <-reg.done:
+		return nil
+	}
+}
+
+// Ping reports whether the registry answers a query before the context is done.
+func (reg *Registry) Ping(ctx context.Context) error {
+	// Buffered, so that the registry does not wait for a caller gone.
+	roomQuery := &roomQuery{room: make(chan *Room, 1)}
+	reg.roomQuery.Write(roomQuery)
+	select {
+	case <-roomQuery.room:
+		return nil
+	case <-reg.done:
+		return ErrServerIsShuttingDown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PingBroker reports whether the broker can be reached before the context is done.
+// It always succeeds without a broker.
+func (reg *Registry) PingBroker(ctx context.Context) error {
+	if reg.broker == nil {
+		return nil
+	}
+	return reg.broker.Ping(ctx)
 }
 
 type roomDeletion struct {
 	roomID string
 	mgtKey string
+
+	// Whether the management key is not checked.
+	force bool
+
+	err chan error
 }
 
-func (reg *Registry) DeleteRoom(roomID string, managementKey string) {
-	reg.roomDeletionRequest <- &roomDeletion{roomID: roomID, mgtKey: managementKey}
+func (reg *Registry) DeleteRoom(roomID string, managementKey string) error {
+	return reg.deleteRoom(&roomDeletion{roomID: roomID, mgtKey: managementKey, err: make(chan error, 1)})
+}
+
+func (reg *Registry) deleteRoom(roomDele *roomDeletion) error {
+	// The room created on another node is deleted through its replica.
+	if reg.GetRoom(roomDele.roomID) == nil {
+		return ErrRoomNotFound
+	}
+	select {
+	case reg.roomDeletionRequest <- roomDele:
+	case <-reg.done:
+		return ErrRoomNotFound
+	}
+	return <-roomDele.err
+}
+
+// getManagedRoom returns the room if the management key matches.
+func (reg *Registry) getManagedRoom(roomID string, managementKey string) (*Room, error) {
+	room := reg.GetRoom(roomID)
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+	if !room.isManager(managementKey) {
+		return nil, ErrWrongManagementKey
+	}
+	return room, nil
+}
+
+func (reg *Registry) RoomInfo(roomID string, managementKey string) (*RoomInfo, error) {
+	room, err := reg.getManagedRoom(roomID, managementKey)
+	if err != nil {
+		return nil, err
+	}
+	reply := make(chan *RoomInfo, 1)
+	room.infoQuery.Write(reply)
+	select {
+	case info := <-reply:
+		return info, nil
+	case <-room.done:
+		return nil, ErrRoomNotFound
+	}
+}
+
+func (reg *Registry) UpdateRoomSettings(roomID string, managementKey string, settings RoomSettings) (*RoomInfo, error) {
+	if settings.MaxMembers != nil && *settings.MaxMembers < 0 {
+		return nil, ErrNotAValidMaxMembers
+	}
+	if settings.Topology != nil && !settings.Topology.IsValid() {
+		return nil, ErrNotAValidTopology
+	}
+	room, err := reg.getManagedRoom(roomID, managementKey)
+	if err != nil {
+		return nil, err
+	}
+	update := &settingsUpdate{settings: settings, info: make(chan *RoomInfo, 1)}
+	room.settingsUpdate.Write(update)
+	select {
+	case info := <-update.info:
+		return info, nil
+	case <-room.done:
+		return nil, ErrRoomNotFound
+	}
+}
+
+// IsMember reports whether the client key belongs to a member of the room
+// or to its creator.
+func (reg *Registry) IsMember(roomID string, clientKey string) bool {
+	room := reg.GetRoom(roomID)
+	if room == nil {
+		return false
+	}
+	if room.isManager(clientKey) {
+		return true
+	}
+	query := &memberQuery{clientKey: clientKey, isMember: make(chan bool, 1)}
+	room.memberQuery.Write(query)
+	select {
+	case isMember := <-query.isMember:
+		return isMember
+	case <-room.done:
+		return false
+	}
 }
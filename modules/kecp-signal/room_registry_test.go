@@ -1,8 +1,10 @@
 package kecpsignal_test
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"log"
 	"math/rand"
 	"net"
@@ -10,6 +12,8 @@ import (
 	"testing"
 	"time"
 
+	kecpbroker "github.com/fourdim/kecp/modules/kecp-broker"
+	kecpfakews "github.com/fourdim/kecp/modules/kecp-fakews"
 	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
 	. "github.com/fourdim/kecp/modules/kecp-signal"
 	"github.com/gorilla/websocket"
@@ -62,3 +66,68 @@ func TestGorillaWebsocketCompatibility(t *testing.T) {
 	assert.NoError(t, err, "error on dialing")
 	<-end
 }
+
+func TestRoomManagement(t *testing.T) {
+	reg := NewRegistry()
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey)
+
+	_, err := reg.RoomInfo(roomID, newKey())
+	assert.EqualError(t, err, ErrWrongManagementKey.Error())
+	_, err = reg.RoomInfo(newKey()[:16], mgtKey)
+	assert.EqualError(t, err, ErrRoomNotFound.Error())
+
+	assert.NoError(t, reg.NewClient(kecpfakews.NewConn(true, roomID, "Alice", newKey())))
+	info, err := reg.RoomInfo(roomID, mgtKey)
+	assert.NoError(t, err)
+	assert.Equal(t, roomID, info.RoomID)
+	assert.Equal(t, 1, info.Members)
+	assert.False(t, info.Locked)
+
+	locked := true
+	info, err = reg.UpdateRoomSettings(roomID, mgtKey, RoomSettings{Locked: &locked})
+	assert.NoError(t, err)
+	assert.True(t, info.Locked)
+	assert.EqualError(t, reg.NewClient(kecpfakews.NewConn(true, roomID, "Bob", newKey())), ErrRoomIsLocked.Error())
+	assert.NoError(t, reg.NewClient(kecpfakews.NewConn(true, roomID, "Carol", mgtKey)))
+
+	assert.EqualError(t, reg.DeleteRoom(roomID, newKey()), ErrWrongManagementKey.Error())
+	assert.NoError(t, reg.DeleteRoom(roomID, mgtKey))
+	assert.Eventually(t, func() bool {
+		_, err := reg.RoomInfo(roomID, mgtKey)
+		return errors.Is(err, ErrRoomNotFound)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestIsMember(t *testing.T) {
+	reg := NewRegistry()
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey)
+	aliceKey := newKey()
+
+	assert.True(t, reg.IsMember(roomID, mgtKey))
+	assert.False(t, reg.IsMember(roomID, aliceKey))
+	assert.NoError(t, reg.NewClient(kecpfakews.NewConn(true, roomID, "Alice", aliceKey)))
+	assert.True(t, reg.IsMember(roomID, aliceKey))
+	assert.False(t, reg.IsMember(roomID, newKey()))
+	assert.False(t, reg.IsMember(newKey()[:16], aliceKey))
+}
+
+func TestPing(t *testing.T) {
+	reg := NewRegistry()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, reg.Ping(ctx))
+	assert.NoError(t, reg.PingBroker(ctx))
+
+	assert.NoError(t, reg.Close())
+	assert.ErrorIs(t, reg.Ping(ctx), ErrServerIsShuttingDown)
+	assert.NoError(t, reg.PingBroker(ctx), "no broker to reach")
+
+	broker := kecpbroker.NewMemory()
+	reg = NewRegistry(WithBroker(broker))
+	defer reg.Close()
+	assert.NoError(t, reg.PingBroker(ctx))
+	assert.NoError(t, broker.Close())
+	assert.ErrorIs(t, reg.PingBroker(ctx), kecpbroker.ErrBrokerIsClosed)
+}
@@ -0,0 +1,119 @@
+package kecpsignal
+
+import (
+	"crypto/subtle"
+	"time"
+
+	kchan "github.com/fourdim/kecp/modules/kecp-channel"
+	kecpcrypto "github.com/fourdim/kecp/modules/kecp-crypto"
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+)
+
+const (
+	// Time a client whose connection was lost is held as away.
+	resumeGracePeriod = 30 * time.Second
+)
+
+// sessions holds the clients whose connection was lost, waiting for a resumption.
+type sessions struct {
+	// The away clients by key.
+	// Only the room's run goroutine can access it.
+	away map[string]*Client
+
+	// Away clients whose grace period is over.
+	expired *kchan.Channel[*Client]
+}
+
+func newSessions() sessions {
+	return sessions{
+		away:    make(map[string]*Client),
+		expired: kchan.New[*Client](),
+	}
+}
+
+// isAway reports whether the client is the away one with its key.
+func (s *sessions) isAway(client *Client) bool {
+	return s.away[client.clientKey] == client
+}
+
+func isResumeToken(client *Client, token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(client.resumeToken), []byte(token)) == 1
+}
+
+// resume attaches the new connection to the session of the previous client
+// with the same key, if the presented resume token matches. The other
+// clients do not see the client leave and join again.
+func resume(room *Room, client *Client) bool {
+	previousClient, away := room.sessions.away[client.clientKey]
+	if !away {
+		// The lost connection may not be noticed yet.
+		previousClient = room.clients[client.clientKey]
+	}
+	if previousClient == nil || previousClient.closed || previousClient.name != client.name ||
+		!isResumeToken(previousClient, client.resumeToken) {
+		return false
+	}
+	delete(room.sessions.away, client.clientKey)
+	room.clients[client.clientKey] = client
+	client.joinSeq = previousClient.joinSeq
+	client.joinedAt = previousClient.joinedAt
+	client.resumeToken = kecpcrypto.GenerateCryptoKey()
+	client.joined <- nil
+	// The messages queued for the away client are handed over to the new
+	// connection. If some were lost, or do not fit, or the writePump of the
+	// previous connection may still be draining them, the client is told
+	// the session was not resumed and starts over from the room state.
+	if !away || previousClient.overflowed || len(previousClient.send) >= cap(client.send) {
+		room.registry.log().Warn("client resumed without the messages queued", clientAttrs(client)...)
+		sendRoomState(room, client)
+		sendToSingleClient(room, client, kecpmsg.NewSessionMsg(client.resumeToken, false))
+	} else {
+		sendToSingleClient(room, client, kecpmsg.NewSessionMsg(client.resumeToken, true))
+	transfer:
+		for {
+			select {
+			case message := <-previousClient.send:
+				sendToSingleClient(room, client, message)
+			default:
+				break transfer
+			}
+		}
+		room.registry.log().Info("client resumed", clientAttrs(client)...)
+	}
+	previousClient.left = true
+	closeClient(previousClient)
+	if away {
+		publishJoin(room, client)
+	}
+	// The new connection may have lost the plan.
+	replan(room)
+	return true
+}
+
+// setAway holds the client, whose connection was lost, for a resumption.
+// The messages for the client are queued in its send channel meanwhile.
+func setAway(room *Room, client *Client) {
+	delete(room.clients, client.clientKey)
+	room.sessions.away[client.clientKey] = client
+	room.registry.log().Info("client away", clientAttrs(client)...)
+	// The client cannot re-broadcast to anyone meanwhile.
+	publishJoin(room, client)
+	replan(room)
+	time.AfterFunc(resumeGracePeriod, func() {
+		room.sessions.expired.Write(client)
+	})
+}
+
+// dismissAway tells the others that the away client left.
+func dismissAway(room *Room, client *Client) {
+	if room.sessions.isAway(client) {
+		delete(room.sessions.away, client.clientKey)
+	}
+	closeClient(client)
+	if !client.left {
+		room.registry.log().Info("client left", clientAttrs(client)...)
+		client.left = true
+		broadcast(room, kecpmsg.NewLeaveMsg(client.name, client.clientKey))
+		replan(room)
+	}
+}
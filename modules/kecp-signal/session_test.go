@@ -0,0 +1,147 @@
+package kecpsignal_test
+
+import (
+	"testing"
+	"time"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func readSession(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	return readMsgOfType(t, conn, kecpmsg.Session).Payload.(map[string]interface{})
+}
+
+func TestSessionResumption(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	roomID := reg.NewRoom(newKey())
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: newKey()})
+	readSession(t, alice)
+	bobKey := newKey()
+	bob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: bobKey})
+	session := readSession(t, bob)
+	assert.Equal(t, false, session["resumed"])
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Join).Payload)
+
+	// Drop the connection without a close message.
+	bob.UnderlyingConn().Close()
+	time.Sleep(100 * time.Millisecond)
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Chat, Name: "Alice", Payload: "missed"})
+
+	bob = dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: bobKey, ResumeToken: session["resume_token"].(string)})
+	first := readMsg(t, bob)
+	assert.Equal(t, kecpmsg.Session, first.Type)
+	resumed := first.Payload.(map[string]interface{})
+	assert.Equal(t, true, resumed["resumed"])
+	assert.NotEqual(t, session["resume_token"], resumed["resume_token"])
+	assert.Equal(t, "missed", readMsgOfType(t, bob, kecpmsg.Chat).Payload)
+
+	// Alice sees no leave or join for Bob.
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Chat, Name: "Alice", Payload: "done"})
+	for {
+		msg := readMsg(t, alice)
+		assert.NotEqual(t, kecpmsg.Leave, msg.Type)
+		assert.NotEqual(t, kecpmsg.Join, msg.Type)
+		if msg.Type == kecpmsg.Chat && msg.Payload == "done" {
+			break
+		}
+	}
+}
+
+func TestSessionResumptionWithWrongToken(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	roomID := reg.NewRoom(newKey())
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: newKey()})
+	readSession(t, alice)
+	bobKey := newKey()
+	bob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: bobKey})
+	readSession(t, bob)
+
+	bob.UnderlyingConn().Close()
+	time.Sleep(100 * time.Millisecond)
+
+	bob = dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: bobKey, ResumeToken: newKey()})
+	assert.Equal(t, kecpmsg.List, readMsg(t, bob).Type)
+	assert.Equal(t, false, readSession(t, bob)["resumed"])
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Leave).Payload)
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Join).Payload)
+}
+
+func TestSessionResumptionOverflow(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	roomID := reg.NewRoom(newKey())
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: newKey()})
+	readSession(t, alice)
+	bobKey := newKey()
+	bob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: bobKey})
+	session := readSession(t, bob)
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Join).Payload)
+
+	// More messages than Bob's queue holds are sent while he is away.
+	bob.UnderlyingConn().Close()
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 300; i++ {
+		writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Chat, Name: "Alice", Payload: "missed"})
+	}
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Chat, Name: "Alice", Payload: "sent"})
+	for readMsgOfType(t, alice, kecpmsg.Chat).Payload != "sent" {
+	}
+
+	// Bob is told to start over, without seeing the messages left.
+	bob = dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: bobKey, ResumeToken: session["resume_token"].(string)})
+	assert.Equal(t, kecpmsg.List, readMsg(t, bob).Type)
+	assert.Equal(t, kecpmsg.Playback, readMsg(t, bob).Type)
+	resumed := readSession(t, bob)
+	assert.Equal(t, false, resumed["resumed"])
+	assert.NotEmpty(t, resumed["resume_token"])
+
+	// Bob is still in the room, Alice sees no leave or join for him.
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Chat, Name: "Alice", Payload: "done"})
+	assert.Equal(t, "done", readMsgOfType(t, bob, kecpmsg.Chat).Payload)
+	for {
+		msg := readMsg(t, alice)
+		assert.NotEqual(t, kecpmsg.Leave, msg.Type)
+		assert.NotEqual(t, kecpmsg.Join, msg.Type)
+		if msg.Type == kecpmsg.Chat && msg.Payload == "done" {
+			break
+		}
+	}
+}
+
+func TestSessionResumptionWhileConnected(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	roomID := reg.NewRoom(newKey())
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: newKey()})
+	readSession(t, alice)
+	bobKey := newKey()
+	bob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: bobKey})
+	session := readSession(t, bob)
+	assert.Equal(t, "Bob", readMsgOfType(t, alice, kecpmsg.Join).Payload)
+
+	// The previous connection is still open, its messages are not handed over.
+	newBob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: bobKey, ResumeToken: session["resume_token"].(string)})
+	assert.Equal(t, kecpmsg.List, readMsg(t, newBob).Type)
+	assert.Equal(t, kecpmsg.Playback, readMsg(t, newBob).Type)
+	assert.Equal(t, false, readSession(t, newBob)["resumed"])
+
+	writeMsg(t, alice, &kecpmsg.Message{Type: kecpmsg.Chat, Name: "Alice", Payload: "done"})
+	assert.Equal(t, "done", readMsgOfType(t, newBob, kecpmsg.Chat).Payload)
+	for {
+		msg := readMsg(t, alice)
+		assert.NotEqual(t, kecpmsg.Leave, msg.Type)
+		assert.NotEqual(t, kecpmsg.Join, msg.Type)
+		if msg.Type == kecpmsg.Chat && msg.Payload == "done" {
+			break
+		}
+	}
+}
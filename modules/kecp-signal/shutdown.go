@@ -0,0 +1,104 @@
+package kecpsignal
+
+import (
+	"context"
+	"time"
+
+	kecpbroker "github.com/fourdim/kecp/modules/kecp-broker"
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	ws "github.com/gorilla/websocket"
+)
+
+// shutdown tells the rooms how to close their clients.
+type shutdown struct {
+	// Whether the clients are told to reconnect after reconnectAfter.
+	restarting     bool
+	reconnectAfter time.Duration
+}
+
+func (reg *Registry) requestShutdown(request *shutdown) {
+	reg.shutdownOnce.Do(func() {
+		select {
+		case reg.shutdownRequest <- request:
+		case <-reg.done:
+		}
+	})
+}
+
+// Shutdown stops accepting new rooms and clients, tells the clients to
+// reconnect after the given delay and closes them. It waits for the rooms
+// and the registry to stop until the context is done.
+// The rooms are kept in the store, and in the broker for kecpbroker.RoomTTL,
+// for the server coming back.
+func (reg *Registry) Shutdown(ctx context.Context, reconnectAfter time.Duration) error {
+	reg.requestShutdown(&shutdown{restarting: true, reconnectAfter: reconnectAfter})
+	select {
+	case <-reg.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes every room and client without telling the clients to reconnect,
+// and waits for the goroutines of the registry, the rooms and the clients to exit.
+// The rooms are kept in the broker and the store.
+func (reg *Registry) Close() error {
+	reg.requestShutdown(&shutdown{})
+	<-reg.done
+	reg.pumpsMu.Lock()
+	reg.closed = true
+	reg.pumpsMu.Unlock()
+	reg.pumps.Wait()
+	reg.outboxes.Wait()
+	reg.events.close()
+	return nil
+}
+
+// trackPumps counts the pumps of a client about to start.
+// It reports false once the registry is closed.
+func (reg *Registry) trackPumps() bool {
+	reg.pumpsMu.Lock()
+	defer reg.pumpsMu.Unlock()
+	if reg.closed {
+		return false
+	}
+	reg.pumps.Add(2)
+	return true
+}
+
+// IsDraining reports whether the registry is shutting down.
+func (reg *Registry) IsDraining() bool {
+	select {
+	case <-reg.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop asks the room to close its clients.
+// Only the registry's run goroutine can call it.
+func (room *Room) stop(request *shutdown) {
+	room.shutdown = request
+	close(room.stopping)
+}
+
+// closeForShutdown closes the clients, telling them when to reconnect
+// if the server is restarting.
+func closeForShutdown(room *Room) {
+	room.stopped = true
+	for _, client := range room.members() {
+		// The other nodes see the client again once it reconnects.
+		publish(room, &kecpbroker.Event{Type: kecpbroker.Leave, Name: client.name})
+	}
+	for _, client := range append(room.members(), room.lobby.waiting...) {
+		if room.shutdown.restarting {
+			client.closeCode = ws.CloseServiceRestart
+			sendToSingleClient(room, client, kecpmsg.NewRestartingMsg(room.shutdown.reconnectAfter))
+		} else {
+			client.closeCode = ws.CloseGoingAway
+		}
+		closeClient(client)
+	}
+}
@@ -0,0 +1,93 @@
+package kecpsignal_test
+
+import (
+	"context"
+	"path/filepath"
+
+	"testing"
+	"time"
+
+	kecpfakews "github.com/fourdim/kecp/modules/kecp-fakews"
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	kecpstore "github.com/fourdim/kecp/modules/kecp-store"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestShutdown(t *testing.T) {
+	store, err := kecpstore.OpenBolt(filepath.Join(t.TempDir(), "kecp.db"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { store.Close() })
+	reg := NewRegistry(WithStore(store))
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey)
+	emptyRoomID := reg.NewRoom(newKey())
+
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	assert.Equal(t, kecpmsg.List, readMsg(t, alice).Type)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, reg.Shutdown(ctx, 3*time.Second))
+	assert.True(t, reg.IsDraining())
+
+	restarting := readMsgOfType(t, alice, kecpmsg.Restarting)
+	assert.Equal(t, 3000.0, restarting.Payload.(map[string]interface{})["reconnect_after"])
+	_, _, err = alice.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseServiceRestart))
+
+	// Nothing new is accepted.
+	assert.Equal(t, "", reg.NewRoom(newKey()))
+	bob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: newKey()})
+	assert.Equal(t, ErrServerIsShuttingDown.Error(), readMsg(t, bob).Payload)
+	assert.Nil(t, reg.GetRoom(roomID))
+
+	// The rooms are kept for the server coming back.
+	assert.True(t, isSaved(t, store, roomID))
+	assert.True(t, isSaved(t, store, emptyRoomID))
+
+	// Shutting down again returns at once.
+	assert.NoError(t, reg.Shutdown(ctx, time.Second))
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey)
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	assert.Equal(t, kecpmsg.List, readMsg(t, alice).Type)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, reg.Shutdown(ctx, time.Second), context.Canceled)
+}
+
+func TestClose(t *testing.T) {
+	// Only the goroutines of this registry are looked at.
+	others := goleak.IgnoreCurrent()
+
+	reg := NewRegistry()
+	for i := 0; i < 3; i++ {
+		roomID := reg.NewRoom(newKey())
+		for j := 0; j < 3; j++ {
+			userKey := newKey()
+			assert.NoError(t, reg.NewClient(kecpfakews.NewConn(true, roomID, userKey[:12], userKey)))
+		}
+	}
+	reg.NewRoom(newKey())
+
+	assert.NoError(t, reg.Close())
+	// The subscriptions of the rooms stop on their own.
+	goleak.VerifyNone(t, others)
+
+	assert.Equal(t, "", reg.NewRoom(newKey()))
+	userKey := newKey()
+	assert.ErrorIs(t, reg.NewClient(kecpfakews.NewConn(true, "room", "Alice", userKey)), ErrServerIsShuttingDown)
+	assert.NoError(t, reg.Close())
+}
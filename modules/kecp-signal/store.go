@@ -0,0 +1,60 @@
+package kecpsignal
+
+import (
+	kecpsfu "github.com/fourdim/kecp/modules/kecp-sfu"
+	kecpstore "github.com/fourdim/kecp/modules/kecp-store"
+)
+
+// WithStore keeps the rooms created on this node in the store,
+// and restores the rooms saved before.
+func WithStore(store kecpstore.Store) RegistryOption {
+	return func(reg *Registry) {
+		reg.store = store
+	}
+}
+
+// restore runs the rooms saved before a restart.
+// Like any new room, they are deleted if no one joins them.
+func (reg *Registry) restore() {
+	records, err := reg.store.Load()
+	if err != nil {
+		reg.log().Error("cannot load the rooms", "error", err)
+		return
+	}
+	for _, stored := range records {
+		record := brokerRecord(stored)
+		room := roomFromRecord(reg, record)
+		if room.relayRequested && reg.relayConfig != nil {
+			room.relay = kecpsfu.New(*reg.relayConfig, room.relayMessage)
+		}
+		putRecord(reg, record)
+		if !room.start() {
+			if room.relay != nil {
+				room.relay.Close()
+			}
+			continue
+		}
+		reg.log().Info("room restored", "room", room.RoomID)
+		notify(room, RoomCreated, "", "")
+	}
+}
+
+// saveRoom saves the room created on this node.
+func saveRoom(room *Room) {
+	if room.replica || room.registry.store == nil {
+		return
+	}
+	if err := room.registry.store.Save(storeRecord(room.record())); err != nil {
+		room.registry.log().Error("cannot save the room", "room", room.RoomID, "error", err)
+	}
+}
+
+// forgetRoom deletes the room created on this node from the store.
+func forgetRoom(room *Room) {
+	if room.replica || room.registry.store == nil {
+		return
+	}
+	if err := room.registry.store.Delete(room.RoomID); err != nil {
+		room.registry.log().Error("cannot forget the room", "room", room.RoomID, "error", err)
+	}
+}
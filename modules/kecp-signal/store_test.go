@@ -0,0 +1,86 @@
+package kecpsignal_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	kecpstore "github.com/fourdim/kecp/modules/kecp-store"
+	"github.com/stretchr/testify/assert"
+)
+
+func isSaved(t *testing.T, store kecpstore.Store, roomID string) bool {
+	records, err := store.Load()
+	assert.NoError(t, err)
+	for _, record := range records {
+		if record.RoomID == roomID {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRoomRestored(t *testing.T) {
+	store, err := kecpstore.OpenBolt(filepath.Join(t.TempDir(), "kecp.db"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { store.Close() })
+
+	before := NewRegistry(WithStore(store))
+	mgtKey := newKey()
+	roomID := before.NewRoom(mgtKey, WithMaxMembers(3), WithPassphrase("secret"), WithTopology(kecpmsg.RelayTree))
+	locked := true
+	_, err = before.UpdateRoomSettings(roomID, mgtKey, RoomSettings{Locked: &locked})
+	assert.NoError(t, err)
+	createdAt := before.GetRoom(roomID).CreatedAt
+
+	// The restarted server has the room.
+	after := NewRegistry(WithStore(store))
+	info, err := after.RoomInfo(roomID, mgtKey)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 3, info.MaxMembers)
+	assert.True(t, info.Locked)
+	assert.True(t, info.Protected)
+	assert.Equal(t, kecpmsg.RelayTree, info.Topology)
+	assert.True(t, createdAt.Equal(info.CreatedAt))
+
+	url := newTestServer(t, after)
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey, Passphrase: "secret"})
+	assert.Equal(t, kecpmsg.List, readMsg(t, alice).Type)
+
+	assert.NoError(t, after.DeleteRoom(roomID, mgtKey))
+	assert.Eventually(t, func() bool {
+		return !isSaved(t, store, roomID)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestInviteUsesRestored(t *testing.T) {
+	store, err := kecpstore.OpenBolt(filepath.Join(t.TempDir(), "kecp.db"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { store.Close() })
+
+	secret := WithInviteSecret([]byte("secret"))
+	before := NewRegistry(secret, WithStore(store))
+	mgtKey := newKey()
+	roomID := before.NewRoom(mgtKey)
+	invite, err := before.NewInvite(roomID, mgtKey, time.Minute, 1)
+	assert.NoError(t, err)
+	alice := dial(t, newTestServer(t, before), kecpmsg.AuthMessage{Name: "Alice", ClientKey: newKey(), Invite: invite.Token})
+	assert.Equal(t, kecpmsg.List, readMsg(t, alice).Type)
+	assert.Eventually(t, func() bool {
+		records, err := store.Load()
+		return err == nil && len(records) == 1 && len(records[0].InviteUses) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// The restarted server remembers who used the invite.
+	after := NewRegistry(secret, WithStore(store))
+	bob := dial(t, newTestServer(t, after), kecpmsg.AuthMessage{Name: "Bob", ClientKey: newKey(), Invite: invite.Token})
+	assert.Equal(t, ErrInviteExhausted.Error(), readMsg(t, bob).Payload)
+}
@@ -0,0 +1,130 @@
+package kecpsignal
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+)
+
+const (
+	// The number of members each member of a relay tree re-broadcasts to.
+	relayTreeFanOut = 3
+)
+
+// plannedMember is a member of the room on any node.
+type plannedMember struct {
+	name     string
+	creator  bool
+	streamer bool
+	away     bool
+	joinSeq  uint64
+}
+
+// orderedMembers returns the members in the order they joined, the creator first.
+func orderedMembers(room *Room) []plannedMember {
+	members := make([]plannedMember, 0, len(room.clients)+len(room.sessions.away)+len(room.remoteMembers))
+	for _, client := range room.members() {
+		members = append(members, plannedMember{
+			name:     client.name,
+			creator:  room.isManager(client.clientKey),
+			streamer: client.name == room.streamer,
+			away:     room.sessions.isAway(client),
+			joinSeq:  client.joinSeq,
+		})
+	}
+	for name, member := range room.remoteMembers {
+		members = append(members, plannedMember{
+			name:     name,
+			creator:  bytes.Equal(member.keyHash, room.mgtKeyHash),
+			streamer: name == room.streamer,
+			away:     member.away,
+			joinSeq:  member.joinSeq,
+		})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].creator != members[j].creator {
+			return members[i].creator
+		}
+		if members[i].joinSeq != members[j].joinSeq {
+			return members[i].joinSeq < members[j].joinSeq
+		}
+		return members[i].name < members[j].name
+	})
+	return members
+}
+
+// relayTreeOrder puts the streaming member first, as the root of a relay tree,
+// and the away members last, as they cannot re-broadcast to anyone.
+func relayTreeOrder(members []plannedMember) []plannedMember {
+	ordered := append([]plannedMember(nil), members...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].away != ordered[j].away {
+			return !ordered[i].away
+		}
+		return ordered[i].streamer && !ordered[j].streamer
+	})
+	return ordered
+}
+
+// planTopology computes the peer connections of each member.
+// Of each pair, the member who came first makes the offer,
+// and the other one is polite, so that the offers never collide.
+func planTopology(topology kecpmsg.Topology, members []plannedMember) map[string][]kecpmsg.PeerLink {
+	links := make(map[string][]kecpmsg.PeerLink, len(members))
+	for _, member := range members {
+		links[member.name] = []kecpmsg.PeerLink{}
+	}
+	connect := func(offerer string, answerer string, both bool) {
+		links[offerer] = append(links[offerer], kecpmsg.PeerLink{Name: answerer, Offer: true, Send: true, Receive: both})
+		links[answerer] = append(links[answerer], kecpmsg.PeerLink{Name: offerer, Polite: true, Send: both, Receive: true})
+	}
+	switch topology {
+	case kecpmsg.RelayTree:
+		members = relayTreeOrder(members)
+		present := 0
+		for present < len(members) && !members[present].away {
+			present++
+		}
+		for i := 1; i < len(members); i++ {
+			parent := (i - 1) / relayTreeFanOut
+			if parent >= present && present > 0 {
+				// The away members hang off the present ones.
+				parent = (i - 1) % present
+			}
+			connect(members[parent].name, members[i].name, false)
+		}
+	default:
+		for i := range members {
+			for j := i + 1; j < len(members); j++ {
+				connect(members[i].name, members[j].name, true)
+			}
+		}
+	}
+	return links
+}
+
+// replan sends the new plan to the members whose plan changed.
+// The members on the other nodes get theirs from their own node.
+func replan(room *Room) {
+	links := planTopology(room.topology, orderedMembers(room))
+	for _, client := range room.members() {
+		plan := &kecpmsg.PeerPlan{Topology: room.topology, Peers: links[client.name]}
+		if reflect.DeepEqual(client.plan, plan) {
+			continue
+		}
+		client.plan = plan
+		sendToSingleClient(room, client, kecpmsg.NewPlanMsg(*plan))
+	}
+}
+
+// followStreamer roots the relay tree at the member who played the media.
+// Every node follows the same playback messages, so they agree on the root.
+func followStreamer(room *Room, name string) {
+	if name == "" || name == room.streamer || room.playback.paused {
+		return
+	}
+	room.streamer = name
+	replan(room)
+}
@@ -0,0 +1,147 @@
+package kecpsignal_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func readPlan(t *testing.T, conn *websocket.Conn) kecpmsg.PeerPlan {
+	b, _ := json.Marshal(readMsgOfType(t, conn, kecpmsg.Plan).Payload)
+	var plan kecpmsg.PeerPlan
+	assert.NoError(t, json.Unmarshal(b, &plan))
+	return plan
+}
+
+func TestMeshPlan(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey)
+
+	bob := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Bob", ClientKey: newKey()})
+	assert.Equal(t, kecpmsg.PeerPlan{Topology: kecpmsg.Mesh, Peers: []kecpmsg.PeerLink{}}, readPlan(t, bob))
+
+	// The creator comes first, even when joining later.
+	alice := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Alice", ClientKey: mgtKey})
+	assert.Equal(t, []kecpmsg.PeerLink{
+		{Name: "Bob", Offer: true, Send: true, Receive: true},
+	}, readPlan(t, alice).Peers)
+	assert.Equal(t, []kecpmsg.PeerLink{
+		{Name: "Alice", Polite: true, Send: true, Receive: true},
+	}, readPlan(t, bob).Peers)
+
+	carol := dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: "Carol", ClientKey: newKey()})
+	assert.Equal(t, []kecpmsg.PeerLink{
+		{Name: "Alice", Polite: true, Send: true, Receive: true},
+		{Name: "Bob", Polite: true, Send: true, Receive: true},
+	}, readPlan(t, carol).Peers)
+	assert.Equal(t, []kecpmsg.PeerLink{
+		{Name: "Alice", Polite: true, Send: true, Receive: true},
+		{Name: "Carol", Offer: true, Send: true, Receive: true},
+	}, readPlan(t, bob).Peers)
+}
+
+func TestRelayTreePlan(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey, WithTopology(kecpmsg.RelayTree))
+
+	conns := make(map[string]*websocket.Conn)
+	for i, name := range []string{"Alice", "Bob", "Carol", "Dave", "Eve"} {
+		key := newKey()
+		if i == 0 {
+			key = mgtKey
+		}
+		conns[name] = dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: name, ClientKey: key})
+		assert.Equal(t, kecpmsg.List, readMsg(t, conns[name]).Type)
+	}
+
+	// Alice streams to Bob, Carol and Dave, and Bob re-broadcasts to Eve.
+	assert.Equal(t, []kecpmsg.PeerLink{
+		{Name: "Bob", Polite: true, Receive: true},
+	}, readPlan(t, conns["Eve"]).Peers)
+	assert.Equal(t, []kecpmsg.PeerLink{
+		{Name: "Alice", Polite: true, Receive: true},
+	}, readPlan(t, conns["Bob"]).Peers)
+	assert.Equal(t, []kecpmsg.PeerLink{
+		{Name: "Alice", Polite: true, Receive: true},
+		{Name: "Eve", Offer: true, Send: true},
+	}, readPlan(t, conns["Bob"]).Peers)
+
+	// The plan is recomputed once Eve leaves.
+	conns["Eve"].WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	assert.Equal(t, []kecpmsg.PeerLink{
+		{Name: "Alice", Polite: true, Receive: true},
+	}, readPlan(t, conns["Bob"]).Peers)
+
+	// Back to the mesh.
+	mesh := kecpmsg.Mesh
+	_, err := reg.UpdateRoomSettings(roomID, mgtKey, RoomSettings{Topology: &mesh})
+	assert.NoError(t, err)
+	assert.Equal(t, []kecpmsg.PeerLink{
+		{Name: "Alice", Polite: true, Receive: true},
+	}, readPlan(t, conns["Dave"]).Peers)
+	plan := readPlan(t, conns["Dave"])
+	assert.Equal(t, kecpmsg.Mesh, plan.Topology)
+	assert.Len(t, plan.Peers, 3)
+
+	invalid := kecpmsg.Topology("star")
+	_, err = reg.UpdateRoomSettings(roomID, mgtKey, RoomSettings{Topology: &invalid})
+	assert.ErrorIs(t, err, ErrNotAValidTopology)
+}
+
+// awaitPlan reads the plans of the member until it gets the peers wanted.
+func awaitPlan(t *testing.T, conn *websocket.Conn, peers []kecpmsg.PeerLink) {
+	var plan kecpmsg.PeerPlan
+	for i := 0; i < 5; i++ {
+		if plan = readPlan(t, conn); assert.ObjectsAreEqual(peers, plan.Peers) {
+			return
+		}
+	}
+	assert.Equal(t, peers, plan.Peers)
+}
+
+func TestRelayTreeRoot(t *testing.T) {
+	reg := NewRegistry()
+	url := newTestServer(t, reg)
+	mgtKey := newKey()
+	roomID := reg.NewRoom(mgtKey, WithTopology(kecpmsg.RelayTree))
+
+	conns := make(map[string]*websocket.Conn)
+	for i, name := range []string{"Alice", "Bob", "Carol", "Dave", "Eve"} {
+		key := newKey()
+		if i == 0 {
+			key = mgtKey
+		}
+		conns[name] = dial(t, url, kecpmsg.AuthMessage{RoomID: roomID, Name: name, ClientKey: key})
+		assert.Equal(t, kecpmsg.List, readMsg(t, conns[name]).Type)
+	}
+
+	// Eve plays the media, so she streams to Alice, Bob and Carol,
+	// and Alice re-broadcasts to Dave.
+	writeMsg(t, conns["Eve"], &kecpmsg.Message{Type: kecpmsg.Play, Name: "Eve", Payload: 0.0})
+	awaitPlan(t, conns["Eve"], []kecpmsg.PeerLink{
+		{Name: "Alice", Offer: true, Send: true},
+		{Name: "Bob", Offer: true, Send: true},
+		{Name: "Carol", Offer: true, Send: true},
+	})
+	awaitPlan(t, conns["Dave"], []kecpmsg.PeerLink{
+		{Name: "Alice", Polite: true, Receive: true},
+	})
+
+	// Alice cannot re-broadcast while she is away.
+	conns["Alice"].UnderlyingConn().Close()
+	awaitPlan(t, conns["Dave"], []kecpmsg.PeerLink{
+		{Name: "Eve", Polite: true, Receive: true},
+	})
+	awaitPlan(t, conns["Bob"], []kecpmsg.PeerLink{
+		{Name: "Eve", Polite: true, Receive: true},
+		{Name: "Alice", Offer: true, Send: true},
+	})
+}
@@ -0,0 +1,74 @@
+package kecpstore
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var roomsBucket = []byte("rooms")
+
+// Bolt is a store in a single file on disk.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens the file, creating it if needed.
+// Only one process can have the file open.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(roomsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+func (b *Bolt) Save(record *RoomRecord) error {
+	if record == nil || record.RoomID == "" {
+		return ErrNotAValidRecord
+	}
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(roomsBucket).Put([]byte(record.RoomID), value)
+	})
+}
+
+func (b *Bolt) Delete(roomID string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(roomsBucket).Delete([]byte(roomID))
+	})
+}
+
+func (b *Bolt) Load() ([]*RoomRecord, error) {
+	var records []*RoomRecord
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(roomsBucket).ForEach(func(key []byte, value []byte) error {
+			var record RoomRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			records = append(records, &record)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
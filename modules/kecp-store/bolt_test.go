@@ -0,0 +1,45 @@
+package kecpstore_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+	. "github.com/fourdim/kecp/modules/kecp-store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBolt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kecp.db")
+	store, err := OpenBolt(path)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	records, err := store.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	record := &RoomRecord{
+		RoomID:     "room",
+		MgtKeyHash: []byte{1, 2, 3},
+		CreatedAt:  time.Unix(1600000000, 0).UTC(),
+		MaxMembers: 4,
+		Topology:   kecpmsg.RelayTree,
+	}
+	assert.NoError(t, store.Save(record))
+	assert.NoError(t, store.Save(&RoomRecord{RoomID: "other"}))
+	assert.NoError(t, store.Delete("other"))
+	assert.ErrorIs(t, store.Save(&RoomRecord{}), ErrNotAValidRecord)
+	assert.NoError(t, store.Close())
+
+	// The rooms are still there once the file is opened again.
+	store, err = OpenBolt(path)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer store.Close()
+	records, err = store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []*RoomRecord{record}, records)
+}
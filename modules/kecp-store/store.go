@@ -0,0 +1,42 @@
+package kecpstore
+
+import (
+	"errors"
+	"time"
+
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
+)
+
+var ErrNotAValidRecord = errors.New("not a valid room record")
+
+// RoomRecord is what a node needs to serve a room again after a restart.
+// It holds no secret in the clear.
+type RoomRecord struct {
+	RoomID         string           `json:"room_id"`
+	MgtKeyHash     []byte           `json:"mgt_key_hash"`
+	PassphraseSalt []byte           `json:"passphrase_salt,omitempty"`
+	PassphraseHash []byte           `json:"passphrase_hash,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	MaxMembers     int              `json:"max_members,omitempty"`
+	Locked         bool             `json:"locked,omitempty"`
+	InviteOnly     bool             `json:"invite_only,omitempty"`
+	Topology       kecpmsg.Topology `json:"topology,omitempty"`
+	Relay          bool             `json:"relay,omitempty"`
+
+	// The clients which joined with each invite, by the invite ID.
+	InviteUses map[string][][]byte `json:"invite_uses,omitempty"`
+}
+
+// Store keeps the rooms across the restarts of the server.
+type Store interface {
+	// Save adds the room, or updates its record.
+	Save(record *RoomRecord) error
+
+	// Delete forgets the room.
+	Delete(roomID string) error
+
+	// Load returns the records of every room saved.
+	Load() ([]*RoomRecord, error)
+
+	Close() error
+}
@@ -0,0 +1,53 @@
+package kecpturn
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Credentials are short-lived TURN credentials following the TURN REST API.
+// The username is the expiry timestamp and the user ID joined by a colon,
+// and the password is the HMAC-SHA1 of the username with the shared secret.
+type Credentials struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	TTL      int64    `json:"ttl"`
+	URIs     []string `json:"uris"`
+}
+
+// CredentialIssuer issues credentials for the TURN servers sharing the secret.
+type CredentialIssuer struct {
+	Secret string
+	TTL    time.Duration
+	URIs   []string
+}
+
+func (issuer *CredentialIssuer) Issue(userID string) *Credentials {
+	username := strconv.FormatInt(time.Now().Add(issuer.TTL).Unix(), 10)
+	if userID != "" {
+		username += ":" + userID
+	}
+	return &Credentials{
+		Username: username,
+		Password: longTermPassword(issuer.Secret, username),
+		TTL:      int64(issuer.TTL / time.Second),
+		URIs:     issuer.URIs,
+	}
+}
+
+func longTermPassword(secret string, username string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// isExpired reports whether the time-windowed username is malformed or expired.
+func isExpired(username string) bool {
+	timestamp, _, _ := strings.Cut(username, ":")
+	expiry, err := strconv.ParseInt(timestamp, 10, 64)
+	return err != nil || expiry < time.Now().Unix()
+}
@@ -0,0 +1,62 @@
+package kecpturn
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strconv"
+
+	"github.com/pion/ice/v2"
+	"github.com/pion/stun"
+)
+
+var ErrUnexpectedResponse = errors.New("unexpected STUN response")
+
+// Ping sends a binding request to the server of the STUN or TURN URL,
+// such as turn:turn.example.com:3478?transport=tcp, and waits for the
+// response until the context is done.
+func Ping(ctx context.Context, rawURL string) error {
+	url, err := ice.ParseURL(rawURL)
+	if err != nil {
+		return err
+	}
+	network := "udp"
+	if url.Proto == ice.ProtoTypeTCP {
+		network = "tcp"
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(url.Host, strconv.Itoa(url.Port)))
+	if err != nil {
+		return err
+	}
+	if url.IsSecure() {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: url.Host})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return err
+		}
+		conn = tlsConn
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	request := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+	if _, err := conn.Write(request.Raw); err != nil {
+		return err
+	}
+	b := make([]byte, 1500)
+	n, err := conn.Read(b)
+	if err != nil {
+		return err
+	}
+	response := &stun.Message{Raw: b[:n]}
+	if err := response.Decode(); err != nil {
+		return err
+	}
+	if response.Type != stun.BindingSuccess || response.TransactionID != request.TransactionID {
+		return ErrUnexpectedResponse
+	}
+	return nil
+}
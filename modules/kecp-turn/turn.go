@@ -0,0 +1,179 @@
+package kecpturn
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/pion/turn/v2"
+)
+
+var (
+	ErrNotAValidRealm    = errors.New("not a valid realm")
+	ErrNotAValidPublicIP = errors.New("not a valid public IP")
+	ErrNotAValidPort     = errors.New("not a valid port")
+	ErrMissingUser       = errors.New("missing user name or password")
+	ErrMissingAuth       = errors.New("missing shared secret or static user")
+)
+
+// ICEServer is advertised to the clients to build their peer connections.
+// It has the shape of the RTCIceServer dictionary.
+type ICEServer struct {
+	URLs       []string `json:"urls" toml:"urls"`
+	Username   string   `json:"username,omitempty" toml:"username"`
+	Credential string   `json:"credential,omitempty" toml:"credential"`
+}
+
+type Config struct {
+	// The realm of the long-term credentials.
+	Realm string
+
+	// The host name, without a port, put in the advertised URLs.
+	// The public IP is used if empty.
+	Host string
+
+	// The IP the clients reach the relays at.
+	PublicIP string
+
+	// The address to listen on, all interfaces if empty.
+	ListenIP string
+
+	// The port to listen on for UDP.
+	UDPPort int
+
+	// The port to listen on for TCP, 0 to disable TCP.
+	TCPPort int
+
+	// The secret shared with the credential issuer, empty to disable
+	// the short-lived credentials.
+	Secret string
+
+	// The static user allowed to allocate relays, empty if there is none.
+	Username string
+	Password string
+}
+
+func (config *Config) validate() error {
+	if config.Realm == "" {
+		return ErrNotAValidRealm
+	}
+	if net.ParseIP(config.PublicIP) == nil {
+		return ErrNotAValidPublicIP
+	}
+	if config.UDPPort <= 0 || config.UDPPort > 65535 || config.TCPPort < 0 || config.TCPPort > 65535 {
+		return ErrNotAValidPort
+	}
+	if (config.Username == "") != (config.Password == "") {
+		return ErrMissingUser
+	}
+	if config.Secret == "" && config.Username == "" {
+		return ErrMissingAuth
+	}
+	return nil
+}
+
+func (config *Config) listenAddress(port int) string {
+	return net.JoinHostPort(config.ListenIP, strconv.Itoa(port))
+}
+
+// Server is a STUN/TURN server relaying the media of the clients
+// which cannot reach each other directly.
+type Server struct {
+	config Config
+	server *turn.Server
+}
+
+// Start listens on the configured ports and serves STUN and TURN.
+func Start(config Config) (*Server, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if config.ListenIP == "" {
+		config.ListenIP = "0.0.0.0"
+	}
+	relayAddressGenerator := &turn.RelayAddressGeneratorStatic{
+		RelayAddress: net.ParseIP(config.PublicIP),
+		Address:      config.ListenIP,
+	}
+	udpListener, err := net.ListenPacket("udp4", config.listenAddress(config.UDPPort))
+	if err != nil {
+		return nil, err
+	}
+	serverConfig := turn.ServerConfig{
+		Realm:       config.Realm,
+		AuthHandler: config.authHandler(),
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn:            udpListener,
+			RelayAddressGenerator: relayAddressGenerator,
+		}},
+	}
+	if config.TCPPort != 0 {
+		tcpListener, err := net.Listen("tcp4", config.listenAddress(config.TCPPort))
+		if err != nil {
+			udpListener.Close()
+			return nil, err
+		}
+		serverConfig.ListenerConfigs = []turn.ListenerConfig{{
+			Listener:              tcpListener,
+			RelayAddressGenerator: relayAddressGenerator,
+		}}
+	}
+	server, err := turn.NewServer(serverConfig)
+	if err != nil {
+		udpListener.Close()
+		for _, listener := range serverConfig.ListenerConfigs {
+			listener.Listener.Close()
+		}
+		return nil, err
+	}
+	return &Server{config: config, server: server}, nil
+}
+
+// authHandler accepts the static user and, if there is a shared secret,
+// the short-lived credentials.
+func (config *Config) authHandler() turn.AuthHandler {
+	key := turn.GenerateAuthKey(config.Username, config.Realm, config.Password)
+	return func(username string, realm string, srcAddr net.Addr) ([]byte, bool) {
+		if config.Username != "" && username == config.Username {
+			return key, true
+		}
+		if config.Secret == "" || isExpired(username) {
+			return nil, false
+		}
+		return turn.GenerateAuthKey(username, realm, longTermPassword(config.Secret, username)), true
+	}
+}
+
+func (s *Server) address(port int) string {
+	host := s.config.Host
+	if host == "" {
+		host = s.config.PublicIP
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// TURNURLs returns the URLs of the TURN server.
+func (s *Server) TURNURLs() []string {
+	urls := []string{fmt.Sprintf("turn:%s?transport=udp", s.address(s.config.UDPPort))}
+	if s.config.TCPPort != 0 {
+		urls = append(urls, fmt.Sprintf("turn:%s?transport=tcp", s.address(s.config.TCPPort)))
+	}
+	return urls
+}
+
+// ICEServers returns the STUN and TURN servers for the clients.
+// The TURN server is listed only with the static user, whose credentials
+// are for the members of the rooms only. The clients fetch short-lived
+// credentials for it otherwise.
+func (s *Server) ICEServers() []ICEServer {
+	iceServers := []ICEServer{{URLs: []string{"stun:" + s.address(s.config.UDPPort)}}}
+	if s.config.Username != "" {
+		iceServers = append(iceServers, ICEServer{URLs: s.TURNURLs(), Username: s.config.Username, Credential: s.config.Password})
+	}
+	return iceServers
+}
+
+func (s *Server) Close() error {
+	return s.server.Close()
+}
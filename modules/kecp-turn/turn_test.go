@@ -0,0 +1,171 @@
+package kecpturn_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/fourdim/kecp/modules/kecp-turn"
+	"github.com/pion/turn/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func freePort(t *testing.T) int {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func newTestConfig(t *testing.T) Config {
+	return Config{
+		Realm:    "kecp",
+		PublicIP: "127.0.0.1",
+		ListenIP: "127.0.0.1",
+		UDPPort:  freePort(t),
+		Username: "kecp",
+		Password: "secret",
+	}
+}
+
+func allocate(t *testing.T, config Config, username string, password string) error {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer conn.Close()
+	address := net.JoinHostPort(config.PublicIP, strconv.Itoa(config.UDPPort))
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: address,
+		TURNServerAddr: address,
+		Username:       username,
+		Password:       password,
+		Realm:          config.Realm,
+		Conn:           conn,
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer client.Close()
+	assert.NoError(t, client.Listen())
+	if _, err := client.SendBindingRequest(); err != nil {
+		return err
+	}
+	relayConn, err := client.Allocate()
+	if err != nil {
+		return err
+	}
+	return relayConn.Close()
+}
+
+func TestServer(t *testing.T) {
+	config := newTestConfig(t)
+	server, err := Start(config)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer server.Close()
+
+	assert.NoError(t, allocate(t, config, "kecp", "secret"))
+	assert.Error(t, allocate(t, config, "kecp", "guess"))
+}
+
+func TestCredentials(t *testing.T) {
+	config := newTestConfig(t)
+	config.Secret = "shared"
+	config.Username = ""
+	config.Password = ""
+	server, err := Start(config)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer server.Close()
+	assert.Len(t, server.ICEServers(), 1)
+
+	issuer := &CredentialIssuer{Secret: "shared", TTL: time.Hour, URIs: server.TURNURLs()}
+	credentials := issuer.Issue("room")
+	assert.Equal(t, int64(3600), credentials.TTL)
+	assert.Equal(t, server.TURNURLs(), credentials.URIs)
+	assert.True(t, strings.HasSuffix(credentials.Username, ":room"))
+	assert.NoError(t, allocate(t, config, credentials.Username, credentials.Password))
+
+	forged := (&CredentialIssuer{Secret: "guess", TTL: time.Hour}).Issue("room")
+	assert.Error(t, allocate(t, config, forged.Username, forged.Password))
+
+	expired := (&CredentialIssuer{Secret: "shared", TTL: -time.Minute}).Issue("room")
+	assert.Error(t, allocate(t, config, expired.Username, expired.Password))
+}
+
+func TestICEServers(t *testing.T) {
+	config := newTestConfig(t)
+	config.Host = "example.com"
+	config.UDPPort = 3478
+	config.TCPPort = 3479
+	server, err := Start(config)
+	if err != nil {
+		t.Skip("the ports are in use")
+	}
+	defer server.Close()
+
+	assert.Equal(t, []ICEServer{
+		{URLs: []string{"stun:example.com:3478"}},
+		{
+			URLs:       []string{"turn:example.com:3478?transport=udp", "turn:example.com:3479?transport=tcp"},
+			Username:   "kecp",
+			Credential: "secret",
+		},
+	}, server.ICEServers())
+}
+
+func TestInvalidConfig(t *testing.T) {
+	config := newTestConfig(t)
+	config.Realm = ""
+	_, err := Start(config)
+	assert.ErrorIs(t, err, ErrNotAValidRealm)
+
+	config = newTestConfig(t)
+	config.PublicIP = "example.com"
+	_, err = Start(config)
+	assert.ErrorIs(t, err, ErrNotAValidPublicIP)
+
+	config = newTestConfig(t)
+	config.UDPPort = 0
+	_, err = Start(config)
+	assert.ErrorIs(t, err, ErrNotAValidPort)
+
+	config = newTestConfig(t)
+	config.Password = ""
+	_, err = Start(config)
+	assert.ErrorIs(t, err, ErrMissingUser)
+
+	config = newTestConfig(t)
+	config.Username = ""
+	config.Password = ""
+	_, err = Start(config)
+	assert.ErrorIs(t, err, ErrMissingAuth)
+}
+
+func TestPing(t *testing.T) {
+	config := newTestConfig(t)
+	config.TCPPort = freePort(t)
+	server, err := Start(config)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, url := range server.TURNURLs() {
+		assert.NoError(t, Ping(ctx, url))
+	}
+	assert.NoError(t, Ping(ctx, server.ICEServers()[0].URLs[0]))
+	assert.Error(t, Ping(ctx, "http://example.com"))
+
+	server.Close()
+	assert.Error(t, Ping(ctx, server.TURNURLs()[0]))
+}
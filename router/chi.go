@@ -4,24 +4,63 @@ import (
 	"net/http"
 
 	kecpsignal "github.com/fourdim/kecp/modules/kecp-signal"
+	kecpturn "github.com/fourdim/kecp/modules/kecp-turn"
 	"github.com/fourdim/kecp/services"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-func SetupKecpChiRouter() *chi.Mux {
-	kecpRouter := chi.NewRouter()
+type KecpOptions struct {
+	// The ICE servers advertised to the clients, the ones with credentials
+	// to the members of the rooms only.
+	ICEServers *services.ICEServerList
+
+	// Issues short-lived TURN credentials, nil if there is no shared secret.
+	TURNCredentials *kecpturn.CredentialIssuer
 
-	reg := kecpsignal.NewRegistry()
+	// The origins of the pages allowed to open a websocket besides this server's.
+	Origins *services.OriginPolicy
+
+	// Counts the websocket upgrades refused for their origin, nil for none.
+	RejectedOrigins prometheus.Counter
+}
+
+func SetupKecpChiRouter(reg *kecpsignal.Registry, options KecpOptions) *chi.Mux {
+	kecpRouter := chi.NewRouter()
 
 	kecpRouter.Route("/", func(r chi.Router) {
 		r.Use(render.SetContentType(render.ContentTypeJSON))
 		r.Post("/", services.NewRoomHandler(reg))
-		r.Get("/", services.NewClientHandler(reg))
+		r.Get("/", services.NewClientHandler(reg, options.Origins, options.RejectedOrigins))
+		r.Get("/ice-servers", services.ICEServersHandler(options.ICEServers))
 		r.Options("/", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 		})
+		r.Route("/{roomID}", func(r chi.Router) {
+			r.Get("/", services.GetRoomHandler(reg))
+			r.Patch("/", services.UpdateRoomHandler(reg))
+			r.Delete("/", services.DeleteRoomHandler(reg))
+			r.Post("/invites", services.NewInviteHandler(reg))
+			r.Get("/turn-credentials", services.TURNCredentialsHandler(reg, options.TURNCredentials, options.ICEServers))
+		})
 	})
 
 	return kecpRouter
 }
+
+// SetupAdminChiRouter serves the operators bearing the admin token.
+func SetupAdminChiRouter(reg *kecpsignal.Registry, adminToken string) *chi.Mux {
+	adminRouter := chi.NewRouter()
+
+	adminRouter.Use(services.AdminOnly(adminToken))
+	adminRouter.Get("/events", services.AdminEventsHandler(reg))
+	adminRouter.Group(func(r chi.Router) {
+		r.Use(render.SetContentType(render.ContentTypeJSON))
+		r.Get("/rooms", services.AdminRoomsHandler(reg))
+		r.Delete("/rooms/{roomID}", services.AdminDeleteRoomHandler(reg))
+		r.Delete("/rooms/{roomID}/members/{name}", services.AdminDisconnectHandler(reg))
+	})
+
+	return adminRouter
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	kecpsignal "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+// Send a comment to the event stream with this period,
+// so that the proxies keep the connection open.
+const eventStreamKeepAlivePeriod = 30 * time.Second
+
+// AdminOnly lets the requests through if they bear the admin token.
+func AdminOnly(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			given, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" || !bearer || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				render.Render(w, r, ErrWrongAdminToken(errors.New("wrong admin token.")))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type MemberResponse struct {
+	Name     string     `json:"name"`
+	Key      string     `json:"key,omitempty"`
+	Addr     string     `json:"addr,omitempty"`
+	JoinedAt *time.Time `json:"joined_at,omitempty"`
+	Away     bool       `json:"away,omitempty"`
+	Waiting  bool       `json:"waiting,omitempty"`
+	Remote   bool       `json:"remote,omitempty"`
+}
+
+type AdminRoomResponse struct {
+	*RoomInfoResponse
+
+	// Seconds since the room was created.
+	Age int64 `json:"age"`
+
+	// Messages per second over the last minute.
+	MessageRate float64 `json:"message_rate"`
+
+	MemberList []MemberResponse `json:"member_list"`
+}
+
+func NewAdminRoomResponse(details *kecpsignal.RoomDetails) *AdminRoomResponse {
+	resp := &AdminRoomResponse{
+		RoomInfoResponse: NewRoomInfoResponse(&details.RoomInfo),
+		Age:              int64(time.Since(details.CreatedAt).Seconds()),
+		MessageRate:      details.MessageRate,
+		MemberList:       []MemberResponse{},
+	}
+	for _, member := range details.MemberList {
+		memberResp := MemberResponse{
+			Name:    member.Name,
+			Key:     member.Key,
+			Addr:    member.Addr,
+			Away:    member.Away,
+			Waiting: member.Waiting,
+			Remote:  member.Remote,
+		}
+		if !member.JoinedAt.IsZero() {
+			joinedAt := member.JoinedAt
+			memberResp.JoinedAt = &joinedAt
+		}
+		resp.MemberList = append(resp.MemberList, memberResp)
+	}
+	return resp
+}
+
+type AdminRoomsResponse struct {
+	Rooms []*AdminRoomResponse `json:"rooms"`
+}
+
+func (resp *AdminRoomsResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// AdminRoomsHandler lists the rooms served by this node with their members.
+func AdminRoomsHandler(reg *kecpsignal.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := &AdminRoomsResponse{Rooms: []*AdminRoomResponse{}}
+		for _, details := range reg.Rooms() {
+			resp.Rooms = append(resp.Rooms, NewAdminRoomResponse(details))
+		}
+		if err := render.Render(w, r, resp); err != nil {
+			render.Render(w, r, ErrRender(err))
+			return
+		}
+	}
+}
+
+// AdminDeleteRoomHandler deletes the room without the management key.
+func AdminDeleteRoomHandler(reg *kecpsignal.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := reg.ForceDeleteRoom(chi.URLParam(r, "roomID")); err != nil {
+			render.Render(w, r, ErrRoom(err))
+			return
+		}
+		render.NoContent(w, r)
+	}
+}
+
+// AdminDisconnectHandler closes the client with the name in the room.
+func AdminDisconnectHandler(reg *kecpsignal.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := reg.Disconnect(chi.URLParam(r, "roomID"), chi.URLParam(r, "name")); err != nil {
+			render.Render(w, r, ErrRoom(err))
+			return
+		}
+		render.NoContent(w, r)
+	}
+}
+
+type RegistryEventResponse struct {
+	Type   kecpsignal.RegistryEventType `json:"type"`
+	Time   time.Time                    `json:"time"`
+	RoomID string                       `json:"room_id"`
+	Name   string                       `json:"name,omitempty"`
+	Key    string                       `json:"key,omitempty"`
+}
+
+// AdminEventsHandler streams the registry events as server-sent events,
+// named after their type.
+func AdminEventsHandler(reg *kecpsignal.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			render.Render(w, r, ErrInternalError(errors.New("streaming is not supported.")))
+			return
+		}
+		events, cancel := reg.Events()
+		defer cancel()
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		keepAlive := time.NewTicker(eventStreamKeepAlivePeriod)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				b, err := json.Marshal(&RegistryEventResponse{
+					Type:   event.Type,
+					Time:   event.Time,
+					RoomID: event.RoomID,
+					Name:   event.Name,
+					Key:    event.Key,
+				})
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, b)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case <-r.Context().Done():
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package services_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	kecpcrypto "github.com/fourdim/kecp/modules/kecp-crypto"
+	kecpsignal "github.com/fourdim/kecp/modules/kecp-signal"
+	. "github.com/fourdim/kecp/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminOnly(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	for _, tt := range []struct {
+		name          string
+		token         string
+		authorization string
+		code          int
+	}{
+		{"right token", "token", "Bearer token", http.StatusNoContent},
+		{"no token set", "", "Bearer ", http.StatusUnauthorized},
+		{"no token given", "token", "", http.StatusUnauthorized},
+		{"wrong token", "token", "Bearer nekot", http.StatusUnauthorized},
+		{"no bearer prefix", "token", "token", http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/rooms", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			AdminOnly(tt.token)(ok).ServeHTTP(rec, req)
+			assert.Equal(t, tt.code, rec.Code)
+		})
+	}
+}
+
+func TestAdminEvents(t *testing.T) {
+	reg := kecpsignal.NewRegistry()
+	defer reg.Close()
+	server := httptest.NewServer(AdminEventsHandler(reg))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// The headers are flushed once the stream is subscribed.
+	roomID := reg.NewRoom(kecpcrypto.GenerateCryptoKey())
+	lines := bufio.NewScanner(resp.Body)
+	assert.True(t, lines.Scan())
+	assert.Equal(t, "event: room-created", lines.Text())
+	assert.True(t, lines.Scan())
+	assert.True(t, strings.HasPrefix(lines.Text(), "data: "))
+	assert.Contains(t, lines.Text(), `"room_id":"`+roomID+`"`)
+	assert.True(t, lines.Scan())
+	assert.Empty(t, lines.Text())
+}
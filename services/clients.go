@@ -1,21 +1,34 @@
 package services
 
 import (
+	"errors"
 	"net/http"
 
 	kecpsignal "github.com/fourdim/kecp/modules/kecp-signal"
 	"github.com/go-chi/render"
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin:     func(r *http.Request) bool { return true },
-}
-
-func NewClientHandler(reg *kecpsignal.Registry) http.HandlerFunc {
+// NewClientHandler upgrades the requests from the origins allowed
+// by the policy to the websockets of the clients. The refused ones are
+// logged with the registry's logger and counted by rejected, if not nil.
+func NewClientHandler(reg *kecpsignal.Registry, origins *OriginPolicy, rejected prometheus.Counter) http.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		// The origin is checked before the upgrade.
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !origins.checkOrigin(r) {
+			reg.Logger().Warn("origin rejected", "origin", r.Header.Get("Origin"), "addr", r.RemoteAddr)
+			if rejected != nil {
+				rejected.Inc()
+			}
+			render.Render(w, r, ErrOriginNotAllowed(errors.New("origin not allowed.")))
+			return
+		}
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			render.Render(w, r, ErrInvalidRequest(err))
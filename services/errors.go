@@ -1,11 +1,31 @@
 package services
 
 import (
+	"errors"
 	"net/http"
 
+	kecpsignal "github.com/fourdim/kecp/modules/kecp-signal"
 	"github.com/go-chi/render"
 )
 
+// Application-specific error codes.
+const (
+	AppCodeInvalidRequest int64 = 1000 + iota
+	AppCodeRenderFailure
+	AppCodeInternalError
+	AppCodeMissingManagementKey
+	AppCodeWrongManagementKey
+	AppCodeRoomNotFound
+	AppCodeMissingClientKey
+	AppCodeNotAMember
+	AppCodeShuttingDown
+	AppCodeWrongAdminToken
+	AppCodeUserNotFound
+	AppCodeOriginNotAllowed
+	AppCodeNoTURNServer
+	AppCodeTooManyRooms
+)
+
 type ErrResponse struct {
 	Err            error `json:"-"` // low-level runtime error
 	HTTPStatusCode int   `json:"-"` // http response status code
@@ -25,6 +45,7 @@ func ErrInvalidRequest(err error) render.Renderer {
 		Err:            err,
 		HTTPStatusCode: 400,
 		StatusText:     "Invalid request.",
+		AppCode:        AppCodeInvalidRequest,
 		ErrorText:      err.Error(),
 	}
 }
@@ -34,6 +55,7 @@ func ErrRender(err error) render.Renderer {
 		Err:            err,
 		HTTPStatusCode: 422,
 		StatusText:     "Error rendering response.",
+		AppCode:        AppCodeRenderFailure,
 		ErrorText:      err.Error(),
 	}
 }
@@ -43,6 +65,129 @@ func ErrInternalError(err error) render.Renderer {
 		Err:            err,
 		HTTPStatusCode: 500,
 		StatusText:     "Internal server error.",
+		AppCode:        AppCodeInternalError,
+		ErrorText:      err.Error(),
+	}
+}
+
+// ErrUnauthorized renders the errors of the management key, taking the
+// app code from the error.
+func ErrUnauthorized(err error) render.Renderer {
+	appCode := AppCodeMissingManagementKey
+	if errors.Is(err, kecpsignal.ErrWrongManagementKey) {
+		appCode = AppCodeWrongManagementKey
+	}
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 401,
+		StatusText:     "Unauthorized.",
+		AppCode:        appCode,
+		ErrorText:      err.Error(),
+	}
+}
+
+func ErrMissingClientKey(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 401,
+		StatusText:     "Unauthorized.",
+		AppCode:        AppCodeMissingClientKey,
+		ErrorText:      err.Error(),
+	}
+}
+
+func ErrNotAMember(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 403,
+		StatusText:     "Forbidden.",
+		AppCode:        AppCodeNotAMember,
+		ErrorText:      err.Error(),
+	}
+}
+
+func ErrShuttingDown(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 503,
+		StatusText:     "Service unavailable.",
+		AppCode:        AppCodeShuttingDown,
 		ErrorText:      err.Error(),
 	}
 }
+
+func ErrWrongAdminToken(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 401,
+		StatusText:     "Unauthorized.",
+		AppCode:        AppCodeWrongAdminToken,
+		ErrorText:      err.Error(),
+	}
+}
+
+func ErrOriginNotAllowed(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 403,
+		StatusText:     "Forbidden.",
+		AppCode:        AppCodeOriginNotAllowed,
+		ErrorText:      err.Error(),
+	}
+}
+
+func ErrNoTURNServer(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 404,
+		StatusText:     "Not found.",
+		AppCode:        AppCodeNoTURNServer,
+		ErrorText:      err.Error(),
+	}
+}
+
+func ErrTooManyRooms(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 503,
+		StatusText:     "Service unavailable.",
+		AppCode:        AppCodeTooManyRooms,
+		ErrorText:      err.Error(),
+	}
+}
+
+// ErrRoom renders the errors returned by the registry's room management.
+func ErrRoom(err error) render.Renderer {
+	switch {
+	case errors.Is(err, kecpsignal.ErrRoomNotFound):
+		return &ErrResponse{
+			Err:            err,
+			HTTPStatusCode: 404,
+			StatusText:     "Room not found.",
+			AppCode:        AppCodeRoomNotFound,
+			ErrorText:      err.Error(),
+		}
+	case errors.Is(err, kecpsignal.ErrUserNotFound):
+		return &ErrResponse{
+			Err:            err,
+			HTTPStatusCode: 404,
+			StatusText:     "User not found.",
+			AppCode:        AppCodeUserNotFound,
+			ErrorText:      err.Error(),
+		}
+	case errors.Is(err, kecpsignal.ErrNotAValidMaxMembers),
+		errors.Is(err, kecpsignal.ErrNotAValidInvite),
+		errors.Is(err, kecpsignal.ErrNotAValidTopology):
+		return ErrInvalidRequest(err)
+	case errors.Is(err, kecpsignal.ErrWrongManagementKey):
+		return &ErrResponse{
+			Err:            err,
+			HTTPStatusCode: 403,
+			StatusText:     "Forbidden.",
+			AppCode:        AppCodeWrongManagementKey,
+			ErrorText:      err.Error(),
+		}
+	default:
+		return ErrInternalError(err)
+	}
+}
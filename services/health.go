@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	kecpsignal "github.com/fourdim/kecp/modules/kecp-signal"
+	"github.com/go-chi/render"
+)
+
+// Time allowed for the readiness checks.
+const readyCheckWait = 2 * time.Second
+
+// ReadyCheck reports why a dependency of the server is not ready, nil if it is.
+type ReadyCheck func(ctx context.Context) error
+
+type HealthResponse struct {
+	HTTPStatusCode int `json:"-"`
+
+	Status string `json:"status"`
+
+	// The result of each readiness check, "ok" or "fail".
+	// Why a check failed is only logged.
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func (resp *HealthResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	render.Status(r, resp.HTTPStatusCode)
+	return nil
+}
+
+// HealthHandler tells that the process is alive.
+func HealthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.Render(w, r, &HealthResponse{HTTPStatusCode: http.StatusOK, Status: "ok"})
+	}
+}
+
+// ReadyHandler tells whether the server can take clients, which is when
+// it is not draining, the registry answers, the broker can be reached
+// and the given checks pass.
+func ReadyHandler(reg *kecpsignal.Registry, checks map[string]ReadyCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if reg.IsDraining() {
+			render.Render(w, r, ErrShuttingDown(kecpsignal.ErrServerIsShuttingDown))
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), readyCheckWait)
+		defer cancel()
+		allChecks := map[string]ReadyCheck{
+			"registry": reg.Ping,
+			"broker":   reg.PingBroker,
+		}
+		for name, check := range checks {
+			allChecks[name] = check
+		}
+		resp := &HealthResponse{HTTPStatusCode: http.StatusOK, Status: "ok", Checks: make(map[string]string)}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for name, check := range allChecks {
+			wg.Add(1)
+			go func(name string, check ReadyCheck) {
+				defer wg.Done()
+				result := "ok"
+				if err := check(ctx); err != nil {
+					slog.Warn("readiness check failed", "check", name, "error", err)
+					result = "fail"
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				resp.Checks[name] = result
+				if result != "ok" {
+					resp.HTTPStatusCode = http.StatusServiceUnavailable
+					resp.Status = "unavailable"
+				}
+			}(name, check)
+		}
+		wg.Wait()
+		render.Render(w, r, resp)
+	}
+}
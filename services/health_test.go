@@ -0,0 +1,51 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	kecpsignal "github.com/fourdim/kecp/modules/kecp-signal"
+	. "github.com/fourdim/kecp/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReady(t *testing.T) {
+	reg := kecpsignal.NewRegistry()
+	defer reg.Close()
+	logs := &syncBuffer{}
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(logs, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	ready := func(checks map[string]ReadyCheck) (int, HealthResponse) {
+		rec := httptest.NewRecorder()
+		ReadyHandler(reg, checks).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var resp HealthResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return rec.Code, resp
+	}
+
+	code, resp := ready(nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]string{"registry": "ok", "broker": "ok"}, resp.Checks)
+
+	// The reason of a failure is logged, not told.
+	code, resp = ready(map[string]ReadyCheck{
+		"turn": func(ctx context.Context) error { return errors.New("turn.internal:3478 unreachable") },
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unavailable", resp.Status)
+	assert.Equal(t, "fail", resp.Checks["turn"])
+	assert.Equal(t, "ok", resp.Checks["registry"])
+	assert.Contains(t, logs.String(), `msg="readiness check failed" check=turn error="turn.internal:3478 unreachable"`)
+
+	// A draining server takes no more clients.
+	assert.NoError(t, reg.Shutdown(context.Background(), 0))
+	code, _ = ready(nil)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
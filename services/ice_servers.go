@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	kecpsignal "github.com/fourdim/kecp/modules/kecp-signal"
+	kecpturn "github.com/fourdim/kecp/modules/kecp-turn"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type ICEServersResponse struct {
+	ICEServers []kecpturn.ICEServer `json:"ice_servers"`
+}
+
+func (resp *ICEServersResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// ICEServerList holds the ICE servers advertised to the clients,
+// which may be replaced while the server runs.
+type ICEServerList struct {
+	mu      sync.RWMutex
+	servers []kecpturn.ICEServer
+}
+
+func NewICEServerList(servers []kecpturn.ICEServer) *ICEServerList {
+	return &ICEServerList{servers: servers}
+}
+
+func (l *ICEServerList) Get() []kecpturn.ICEServer {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.servers
+}
+
+func (l *ICEServerList) Set(servers []kecpturn.ICEServer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.servers = servers
+}
+
+// splitICEServers tells the ICE servers anyone may know apart from the ones
+// with credentials, which are only given to the members of a room.
+func splitICEServers(servers []kecpturn.ICEServer) (public []kecpturn.ICEServer, private []kecpturn.ICEServer) {
+	for _, server := range servers {
+		if server.Username == "" && server.Credential == "" {
+			public = append(public, server)
+		} else {
+			private = append(private, server)
+		}
+	}
+	return public, private
+}
+
+// ICEServersHandler tells anyone the ICE servers without credentials.
+func ICEServersHandler(iceServers *ICEServerList) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		public, _ := splitICEServers(iceServers.Get())
+		if public == nil {
+			public = []kecpturn.ICEServer{}
+		}
+		if err := render.Render(w, r, &ICEServersResponse{ICEServers: public}); err != nil {
+			render.Render(w, r, ErrRender(err))
+			return
+		}
+	}
+}
+
+type TURNCredentialsResponse struct {
+	// The short-lived credentials, nil if there is no shared secret.
+	*kecpturn.Credentials
+
+	// The ICE servers with static credentials.
+	ICEServers []kecpturn.ICEServer `json:"ice_servers,omitempty"`
+}
+
+func (resp *TURNCredentialsResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// TURNCredentialsHandler gives the members of the room, who authenticate with
+// their client key as the bearer token, short-lived TURN credentials if there
+// is an issuer, and the ICE servers with static credentials.
+func TURNCredentialsHandler(reg *kecpsignal.Registry, issuer *kecpturn.CredentialIssuer, iceServers *ICEServerList) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := bearerKey(r)
+		if !ok {
+			render.Render(w, r, ErrMissingClientKey(errors.New("missing client key.")))
+			return
+		}
+		roomID := chi.URLParam(r, "roomID")
+		if !reg.IsMember(roomID, key) {
+			render.Render(w, r, ErrNotAMember(errors.New("not a member of the room.")))
+			return
+		}
+		_, private := splitICEServers(iceServers.Get())
+		if issuer == nil && len(private) == 0 {
+			render.Render(w, r, ErrNoTURNServer(errors.New("no TURN server.")))
+			return
+		}
+		resp := &TURNCredentialsResponse{ICEServers: private}
+		if issuer != nil {
+			resp.Credentials = issuer.Issue(roomID)
+		}
+		if err := render.Render(w, r, resp); err != nil {
+			render.Render(w, r, ErrRender(err))
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package services_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	kecpcrypto "github.com/fourdim/kecp/modules/kecp-crypto"
+	kecpsignal "github.com/fourdim/kecp/modules/kecp-signal"
+	kecpturn "github.com/fourdim/kecp/modules/kecp-turn"
+	. "github.com/fourdim/kecp/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestICEServers(t *testing.T) {
+	reg := kecpsignal.NewRegistry()
+	defer reg.Close()
+	iceServers := NewICEServerList([]kecpturn.ICEServer{
+		{URLs: []string{"stun:stun.example.com:3478"}},
+		{URLs: []string{"turn:turn.example.com:3478"}, Username: "kecp", Credential: "password"},
+	})
+	r := chi.NewRouter()
+	r.Get("/ice-servers", ICEServersHandler(iceServers))
+	r.Get("/{roomID}/turn-credentials", TURNCredentialsHandler(reg, nil, iceServers))
+	get := func(path string, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Anyone learns the servers without credentials.
+	rec := get("/ice-servers", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var public ICEServersResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &public))
+	assert.Equal(t, []kecpturn.ICEServer{{URLs: []string{"stun:stun.example.com:3478"}}}, public.ICEServers)
+	assert.NotContains(t, rec.Body.String(), "password")
+
+	// Only the members get the credentials.
+	mgtKey := kecpcrypto.GenerateCryptoKey()
+	roomID := reg.NewRoom(mgtKey)
+	assert.Equal(t, http.StatusUnauthorized, get("/"+roomID+"/turn-credentials", "").Code)
+	assert.Equal(t, http.StatusForbidden, get("/"+roomID+"/turn-credentials", kecpcrypto.GenerateCryptoKey()).Code)
+	rec = get("/"+roomID+"/turn-credentials", mgtKey)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var private TURNCredentialsResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &private))
+	assert.Nil(t, private.Credentials)
+	assert.Equal(t, []kecpturn.ICEServer{{URLs: []string{"turn:turn.example.com:3478"}, Username: "kecp", Credential: "password"}}, private.ICEServers)
+
+	r = chi.NewRouter()
+	issuer := &kecpturn.CredentialIssuer{Secret: "secret", TTL: time.Hour, URIs: []string{"turn:turn.example.com:3478"}}
+	r.Get("/{roomID}/turn-credentials", TURNCredentialsHandler(reg, issuer, NewICEServerList(nil)))
+	rec = get("/"+roomID+"/turn-credentials", mgtKey)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	private = TURNCredentialsResponse{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &private))
+	if assert.NotNil(t, private.Credentials) {
+		assert.Equal(t, int64(3600), private.TTL)
+	}
+	assert.Empty(t, private.ICEServers)
+
+	r = chi.NewRouter()
+	r.Get("/{roomID}/turn-credentials", TURNCredentialsHandler(reg, nil, NewICEServerList(public.ICEServers)))
+	assert.Equal(t, http.StatusNotFound, get("/"+roomID+"/turn-credentials", mgtKey).Code)
+}
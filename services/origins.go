@@ -0,0 +1,106 @@
+package services
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AllowAnyOrigin in the allowed origins lets the pages of any site open a websocket.
+const AllowAnyOrigin = "*"
+
+// NewRejectedOriginsCounter makes the counter of the websocket upgrades
+// refused for their origin, to be registered by the caller.
+func NewRejectedOriginsCounter() prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "kecp",
+		Name:      "rejected_origins_total",
+		Help:      "Websocket upgrades refused for their origin.",
+	})
+}
+
+// OriginPolicy decides which pages may open a websocket, besides the ones
+// served by this server. The origins are like https://example.com, and
+// https://*.example.com allows the subdomains of example.com.
+type OriginPolicy struct {
+	mu       sync.RWMutex
+	allowAny bool
+	exact    map[string]bool
+
+	// The suffixes of the wildcard origins, like .example.com,
+	// by the scheme.
+	wildcards map[string][]string
+}
+
+func NewOriginPolicy(origins []string) *OriginPolicy {
+	p := &OriginPolicy{}
+	p.Update(origins)
+	return p
+}
+
+// Update replaces the allowed origins, for the upgrades to come.
+func (p *OriginPolicy) Update(origins []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.allowAny = false
+	p.exact = make(map[string]bool)
+	p.wildcards = make(map[string][]string)
+	for _, origin := range origins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == AllowAnyOrigin:
+			p.allowAny = true
+		case origin == "":
+		default:
+			scheme, host, ok := strings.Cut(origin, "://")
+			if ok && strings.HasPrefix(host, "*.") {
+				p.wildcards[scheme] = append(p.wildcards[scheme], host[1:])
+			} else {
+				p.exact[origin] = true
+			}
+		}
+	}
+}
+
+// Allows tells whether the page of the origin may open a websocket.
+func (p *OriginPolicy) Allows(origin string) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.allowAny {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.exact[origin] {
+		return true
+	}
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok || strings.ContainsAny(host, "/@?#") {
+		return false
+	}
+	for _, suffix := range p.wildcards[scheme] {
+		if len(host) > len(suffix) && strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin lets through the requests without an origin, which are not
+// from a browser, the ones from the pages of this server and the ones
+// allowed by the policy.
+func (p *OriginPolicy) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return p.Allows(origin)
+}
@@ -0,0 +1,105 @@
+package services_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	kecpsignal "github.com/fourdim/kecp/modules/kecp-signal"
+	. "github.com/fourdim/kecp/services"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer collects the logs of the handlers.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// upgrade dials the handler from the page of the origin and returns the status of the upgrade.
+func upgrade(t *testing.T, handler http.Handler, origin string) int {
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	header := http.Header{}
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), header)
+	if err == nil {
+		conn.Close()
+	}
+	if !assert.NotNil(t, resp) {
+		t.FailNow()
+	}
+	return resp.StatusCode
+}
+
+func TestOriginPolicy(t *testing.T) {
+	p := NewOriginPolicy([]string{"https://example.com", "https://*.example.org", ""})
+	assert.True(t, p.Allows("https://example.com"))
+	assert.True(t, p.Allows("HTTPS://Example.com"))
+	assert.False(t, p.Allows("http://example.com"))
+	assert.False(t, p.Allows("https://www.example.com"))
+	assert.True(t, p.Allows("https://www.example.org"))
+	assert.True(t, p.Allows("https://a.b.example.org"))
+	assert.False(t, p.Allows("https://example.org"))
+	assert.False(t, p.Allows("http://www.example.org"))
+	assert.False(t, p.Allows("https://evil.com/.example.org"))
+	assert.False(t, p.Allows("https://evilexample.org"))
+	assert.False(t, p.Allows(""))
+
+	assert.True(t, NewOriginPolicy([]string{AllowAnyOrigin}).Allows("https://evil.com"))
+	p.Update([]string{"https://example.net"})
+	assert.True(t, p.Allows("https://example.net"))
+	assert.False(t, p.Allows("https://example.com"))
+	assert.False(t, p.Allows("https://www.example.org"))
+
+	var none *OriginPolicy
+	assert.False(t, none.Allows("https://example.com"))
+}
+
+func TestClientHandlerOrigins(t *testing.T) {
+	logs := &syncBuffer{}
+	reg := kecpsignal.NewRegistry(kecpsignal.WithLogger(slog.New(slog.NewTextHandler(logs, nil))))
+	defer reg.Close()
+	rejected := NewRejectedOriginsCounter()
+
+	handler := NewClientHandler(reg, NewOriginPolicy([]string{"https://*.example.org"}), rejected)
+	assert.Equal(t, http.StatusSwitchingProtocols, upgrade(t, handler, ""), "not from a browser")
+	assert.Equal(t, http.StatusSwitchingProtocols, upgrade(t, handler, "https://www.example.org"))
+
+	assert.Equal(t, http.StatusForbidden, upgrade(t, handler, "https://evil.com"))
+	assert.Equal(t, http.StatusForbidden, upgrade(t, handler, "https://example.org"))
+	assert.Equal(t, 2.0, testutil.ToFloat64(rejected))
+	assert.Contains(t, logs.String(), `msg="origin rejected" origin=https://evil.com`)
+
+	// The pages of this server are always allowed.
+	srv := httptest.NewServer(NewClientHandler(reg, nil, nil))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{"Origin": {srv.URL}})
+	if assert.NoError(t, err) {
+		conn.Close()
+	}
+	assert.Equal(t, http.StatusForbidden, upgrade(t, NewClientHandler(reg, nil, nil), "https://www.example.org"))
+
+	handler = NewClientHandler(reg, NewOriginPolicy([]string{AllowAnyOrigin}), nil)
+	assert.Equal(t, http.StatusSwitchingProtocols, upgrade(t, handler, "https://evil.com"))
+}
@@ -3,20 +3,56 @@ package services
 import (
 	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	kecpmsg "github.com/fourdim/kecp/modules/kecp-msg"
 	kecpsignal "github.com/fourdim/kecp/modules/kecp-signal"
 	kecpvalidate "github.com/fourdim/kecp/modules/kecp-validate"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 )
 
+const (
+	maxPassphraseLength = 256
+
+	// The longest an invite can be valid for, in seconds.
+	maxInviteExpiresIn = 30 * 24 * 60 * 60
+)
+
 type CreateRoomRequest struct {
 	ClientKey string `json:"client_key"`
+
+	// The maximum member count, 0 for unlimited.
+	MaxMembers int `json:"max_members,omitempty"`
+
+	// The optional passphrase required to join.
+	Passphrase string `json:"passphrase,omitempty"`
+
+	// Whether an invite is required to join.
+	InviteOnly bool `json:"invite_only,omitempty"`
+
+	// Whether the clients can offer their tracks to the server,
+	// which forwards them to the other members.
+	Relay bool `json:"relay,omitempty"`
+
+	// The shape of the peer connections, mesh by default.
+	Topology kecpmsg.Topology `json:"topology,omitempty"`
 }
 
 func (req *CreateRoomRequest) Bind(r *http.Request) error {
 	if !kecpvalidate.IsAValidCryptoKey(req.ClientKey) {
 		return errors.New("malformed client key.")
 	}
+	if req.MaxMembers < 0 {
+		return kecpsignal.ErrNotAValidMaxMembers
+	}
+	if len(req.Passphrase) > maxPassphraseLength {
+		return kecpsignal.ErrNotAValidPassphrase
+	}
+	if req.Topology != "" && !req.Topology.IsValid() {
+		return kecpsignal.ErrNotAValidTopology
+	}
 	return nil
 }
 
@@ -38,7 +74,25 @@ func NewRoomHandler(reg *kecpsignal.Registry) http.HandlerFunc {
 			render.Render(w, r, ErrInvalidRequest(err))
 			return
 		}
-		roomID := reg.NewRoom(req.ClientKey)
+		if reg.IsDraining() {
+			render.Render(w, r, ErrShuttingDown(kecpsignal.ErrServerIsShuttingDown))
+			return
+		}
+		roomID := reg.NewRoom(req.ClientKey,
+			kecpsignal.WithMaxMembers(req.MaxMembers),
+			kecpsignal.WithPassphrase(req.Passphrase),
+			kecpsignal.WithInviteOnly(req.InviteOnly),
+			kecpsignal.WithRelay(req.Relay),
+			kecpsignal.WithTopology(req.Topology),
+		)
+		if roomID == "" && reg.IsDraining() {
+			render.Render(w, r, ErrShuttingDown(kecpsignal.ErrServerIsShuttingDown))
+			return
+		}
+		if roomID == "" {
+			render.Render(w, r, ErrTooManyRooms(kecpsignal.ErrTooManyRooms))
+			return
+		}
 		resp := &CreateRoomResponse{RoomID: roomID}
 		if err := render.Render(w, r, resp); err != nil {
 			render.Render(w, r, ErrInternalError(err))
@@ -46,3 +100,181 @@ func NewRoomHandler(reg *kecpsignal.Registry) http.HandlerFunc {
 		}
 	}
 }
+
+type RoomInfoResponse struct {
+	RoomID     string           `json:"room_id"`
+	Members    int              `json:"members"`
+	Waiting    int              `json:"waiting"`
+	MaxMembers int              `json:"max_members"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Locked     bool             `json:"locked"`
+	InviteOnly bool             `json:"invite_only"`
+	Protected  bool             `json:"protected"`
+	Relay      bool             `json:"relay"`
+	Topology   kecpmsg.Topology `json:"topology"`
+}
+
+func NewRoomInfoResponse(info *kecpsignal.RoomInfo) *RoomInfoResponse {
+	return &RoomInfoResponse{
+		RoomID:     info.RoomID,
+		Members:    info.Members,
+		Waiting:    info.Waiting,
+		MaxMembers: info.MaxMembers,
+		CreatedAt:  info.CreatedAt,
+		Locked:     info.Locked,
+		InviteOnly: info.InviteOnly,
+		Protected:  info.Protected,
+		Relay:      info.Relay,
+		Topology:   info.Topology,
+	}
+}
+
+func (resp *RoomInfoResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type UpdateRoomRequest struct {
+	Locked     *bool             `json:"locked"`
+	MaxMembers *int              `json:"max_members"`
+	InviteOnly *bool             `json:"invite_only"`
+	Topology   *kecpmsg.Topology `json:"topology"`
+}
+
+func (req *UpdateRoomRequest) Bind(r *http.Request) error {
+	if req.Locked == nil && req.MaxMembers == nil && req.InviteOnly == nil && req.Topology == nil {
+		return errors.New("no settings to update.")
+	}
+	if req.MaxMembers != nil && *req.MaxMembers < 0 {
+		return kecpsignal.ErrNotAValidMaxMembers
+	}
+	return nil
+}
+
+// bearerKey reads the key from the bearer token.
+func bearerKey(r *http.Request) (string, bool) {
+	key, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return key, bearer && kecpvalidate.IsAValidCryptoKey(key)
+}
+
+// managementKey reads the management key from the bearer token.
+func managementKey(r *http.Request) (string, error) {
+	key, ok := bearerKey(r)
+	if !ok {
+		return "", errors.New("missing management key.")
+	}
+	return key, nil
+}
+
+func GetRoomHandler(reg *kecpsignal.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := managementKey(r)
+		if err != nil {
+			render.Render(w, r, ErrUnauthorized(err))
+			return
+		}
+		info, err := reg.RoomInfo(chi.URLParam(r, "roomID"), key)
+		if err != nil {
+			render.Render(w, r, ErrRoom(err))
+			return
+		}
+		if err := render.Render(w, r, NewRoomInfoResponse(info)); err != nil {
+			render.Render(w, r, ErrRender(err))
+			return
+		}
+	}
+}
+
+func UpdateRoomHandler(reg *kecpsignal.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := managementKey(r)
+		if err != nil {
+			render.Render(w, r, ErrUnauthorized(err))
+			return
+		}
+		req := &UpdateRoomRequest{}
+		if err := render.Bind(r, req); err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		info, err := reg.UpdateRoomSettings(chi.URLParam(r, "roomID"), key, kecpsignal.RoomSettings{
+			Locked:     req.Locked,
+			MaxMembers: req.MaxMembers,
+			InviteOnly: req.InviteOnly,
+			Topology:   req.Topology,
+		})
+		if err != nil {
+			render.Render(w, r, ErrRoom(err))
+			return
+		}
+		if err := render.Render(w, r, NewRoomInfoResponse(info)); err != nil {
+			render.Render(w, r, ErrRender(err))
+			return
+		}
+	}
+}
+
+func DeleteRoomHandler(reg *kecpsignal.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := managementKey(r)
+		if err != nil {
+			render.Render(w, r, ErrUnauthorized(err))
+			return
+		}
+		if err := reg.DeleteRoom(chi.URLParam(r, "roomID"), key); err != nil {
+			render.Render(w, r, ErrRoom(err))
+			return
+		}
+		render.NoContent(w, r)
+	}
+}
+
+type CreateInviteRequest struct {
+	// Seconds until the invite expires.
+	ExpiresIn int64 `json:"expires_in"`
+
+	// The number of distinct clients allowed to join, 0 for unlimited.
+	MaxUses int `json:"max_uses,omitempty"`
+}
+
+func (req *CreateInviteRequest) Bind(r *http.Request) error {
+	if req.ExpiresIn <= 0 || req.ExpiresIn > maxInviteExpiresIn || req.MaxUses < 0 {
+		return kecpsignal.ErrNotAValidInvite
+	}
+	return nil
+}
+
+type InviteResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	MaxUses   int       `json:"max_uses"`
+}
+
+func (resp *InviteResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusCreated)
+	return nil
+}
+
+func NewInviteHandler(reg *kecpsignal.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := managementKey(r)
+		if err != nil {
+			render.Render(w, r, ErrUnauthorized(err))
+			return
+		}
+		req := &CreateInviteRequest{}
+		if err := render.Bind(r, req); err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		invite, err := reg.NewInvite(chi.URLParam(r, "roomID"), key, time.Duration(req.ExpiresIn)*time.Second, req.MaxUses)
+		if err != nil {
+			render.Render(w, r, ErrRoom(err))
+			return
+		}
+		resp := &InviteResponse{Token: invite.Token, ExpiresAt: invite.ExpiresAt, MaxUses: invite.MaxUses}
+		if err := render.Render(w, r, resp); err != nil {
+			render.Render(w, r, ErrRender(err))
+			return
+		}
+	}
+}
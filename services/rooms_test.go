@@ -0,0 +1,62 @@
+package services_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	kecpcrypto "github.com/fourdim/kecp/modules/kecp-crypto"
+	kecpsignal "github.com/fourdim/kecp/modules/kecp-signal"
+	. "github.com/fourdim/kecp/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRoom(t *testing.T) {
+	reg := kecpsignal.NewRegistry()
+	defer reg.Close()
+	r := chi.NewRouter()
+	r.Get("/{roomID}", GetRoomHandler(reg))
+	mgtKey := kecpcrypto.GenerateCryptoKey()
+	roomID := reg.NewRoom(mgtKey)
+	for _, tt := range []struct {
+		name          string
+		authorization string
+		code          int
+	}{
+		{"management key", "Bearer " + mgtKey, http.StatusOK},
+		{"no key", "", http.StatusUnauthorized},
+		{"no bearer prefix", mgtKey, http.StatusUnauthorized},
+		{"other scheme", "Basic " + mgtKey, http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+roomID, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(t, tt.code, rec.Code)
+		})
+	}
+}
+
+func TestErrUnauthorized(t *testing.T) {
+	for _, tt := range []struct {
+		err     error
+		appCode int64
+	}{
+		{errors.New("missing management key."), AppCodeMissingManagementKey},
+		{kecpsignal.ErrWrongManagementKey, AppCodeWrongManagementKey},
+	} {
+		rec := httptest.NewRecorder()
+		render.Render(rec, httptest.NewRequest(http.MethodGet, "/", nil), ErrUnauthorized(tt.err))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		var resp ErrResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, tt.appCode, resp.AppCode)
+	}
+}